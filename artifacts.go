@@ -0,0 +1,150 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dr2chase/gossahash/search"
+)
+
+// collectArtifacts reruns the failing configuration of ss, and the
+// configuration with no hashes enabled (which should pass), with
+// GOSSAFUNC set to the culprit function and GOSSADIR and -gcflags set
+// so that the compiler writes ssa.html and assembly, and saves them
+// in dir, along with a diff of the function's assembly.
+func collectArtifacts(dir string, ss *search.State, oracle *search.CommandOracle) {
+	fn := gossafunc(ss.LastTrigger)
+	if fn == "" {
+		fmt.Printf("No function for GOSSAFUNC, not collecting artifacts for %s\n", ss.Env(false))
+		return
+	}
+	fmt.Printf("Collecting artifacts for %s in %s\n", fn, dir)
+
+	configs := []struct {
+		name string
+		env  string
+	}{
+		{"fail", ss.Env(false)},
+		{"pass", fmt.Sprintf("%s%s=%sn", envEnvPrefix, hash_ev_string, hashPrefix)},
+	}
+	file := fileName(fn)
+	var asms []string
+	for _, c := range configs {
+		cdir := filepath.Join(dir, c.name)
+		if err := os.MkdirAll(cdir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating artifact directory %s\n", err)
+			return
+		}
+		abs, _ := filepath.Abs(cdir)
+
+		// Trigger lines are not needed, so the output is always
+		// the command's, including any assembly.  Stop rules would
+		// end the run before all of it is written.
+		o := *oracle
+		o.LogFile = ""
+		o.TmpDir = ""
+		o.Stop = nil
+		o.Env = append(append([]string{}, oracle.Env...), "GOSSAFUNC="+fn, "GOSSADIR="+abs)
+		if artifactGcflags != "" {
+			goflags := strings.TrimSpace(os.Getenv("GOFLAGS") + " -gcflags=" + artifactGcflags)
+			o.Env = append(o.Env, "GOFLAGS="+goflags)
+		}
+		out := o.Try(context.Background(), &search.Trial{Env: c.env, Name: hash_ev_name})
+
+		fmt.Printf("%s configuration %s (%s)\n", c.name, outcomeString(out), c.env)
+		save(filepath.Join(cdir, "output.txt"), out.Output)
+		asm := filepath.Join(cdir, file+".s")
+		save(asm, assembly(out.Output, fn))
+		asms = append(asms, asm)
+	}
+
+	diff, err := exec.Command("diff", "-u", asms[1], asms[0]).CombinedOutput()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		fmt.Fprintf(os.Stderr, "Error running diff %s\n", err)
+		return
+	}
+	save(filepath.Join(dir, file+".s.diff"), diff)
+}
+
+// outcomeString describes o in a word.
+func outcomeString(o *search.Outcome) string {
+	switch {
+	case o.Skipped:
+		return "skipped"
+	case o.Unrelated:
+		return "failed (unrelated)"
+	case o.Failed:
+		return "failed"
+	}
+	return "passed"
+}
+
+// fileName returns fn with each character that is awkward in a file
+// name, such as the slashes of a package path or the parentheses and
+// star of a method like p.(*T).M, replaced by an underscore.
+func fileName(fn string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, fn)
+}
+
+// save writes data to file, reporting any error.
+func save(file string, data []byte) {
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving %s\n", err)
+	}
+}
+
+// assembly extracts the assembly for function fn from compiler -S
+// output, in which each function's listing begins with an unindented
+// line like
+//
+//	main.fn STEXT size=128 args=0x8 locals=0x18 funcid=0x0 align=0x0
+//
+// followed by indented lines of instructions and data.
+func assembly(output []byte, fn string) []byte {
+	var b bytes.Buffer
+	in := false
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] != ' ' && line[0] != '\t' {
+			in = false
+			if i := strings.Index(line, " STEXT"); i != -1 {
+				name := line[:i]
+				in = name == fn || strings.HasSuffix(name, "."+fn)
+			}
+		}
+		if in {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+const asmOutput = `# example.com/p
+example.com/p.F STEXT size=16 args=0x0 locals=0x0 funcid=0x0 align=0x0
+	0x0000 00000 (p.go:3)	TEXT	example.com/p.F(SB), ABIInternal, $0-0
+	0x0000 00000 (p.go:3)	RET
+	0x0000 c3                                               .
+example.com/p.(*T).M STEXT size=8 args=0x8 locals=0x0 funcid=0x0 align=0x0
+	0x0000 00000 (p.go:5)	TEXT	example.com/p.(*T).M(SB), ABIInternal, $0-8
+	0x0000 00000 (p.go:5)	RET
+example.com/p.F.func1 STEXT size=8 args=0x0 locals=0x0 funcid=0x0 align=0x0
+	0x0000 00000 (p.go:4)	RET
+go:cuinfo.producer.example.com/p SDWARDCUINFO dupok size=0
+ok  	example.com/p	0.01s
+`
+
+func TestAssembly(t *testing.T) {
+	tests := []struct {
+		fn   string
+		want string
+	}{
+		{"example.com/p.F", `example.com/p.F STEXT size=16 args=0x0 locals=0x0 funcid=0x0 align=0x0
+	0x0000 00000 (p.go:3)	TEXT	example.com/p.F(SB), ABIInternal, $0-0
+	0x0000 00000 (p.go:3)	RET
+	0x0000 c3                                               .
+`},
+		{"F", `example.com/p.F STEXT size=16 args=0x0 locals=0x0 funcid=0x0 align=0x0
+	0x0000 00000 (p.go:3)	TEXT	example.com/p.F(SB), ABIInternal, $0-0
+	0x0000 00000 (p.go:3)	RET
+	0x0000 c3                                               .
+`}, // a name without its package
+		{"p.F", ""}, // not a whole package path
+		{"example.com/p.(*T).M", `example.com/p.(*T).M STEXT size=8 args=0x8 locals=0x0 funcid=0x0 align=0x0
+	0x0000 00000 (p.go:5)	TEXT	example.com/p.(*T).M(SB), ABIInternal, $0-8
+	0x0000 00000 (p.go:5)	RET
+`},
+		{"example.com/p.G", ""},
+	}
+	for _, test := range tests {
+		if got := string(assembly([]byte(asmOutput), test.fn)); got != test.want {
+			t.Errorf("assembly(%q) =\n%s\nwant\n%s", test.fn, got, test.want)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	for fn, want := range map[string]string{
+		"main.f":                       "main.f",
+		"example.com/p.(*T).M":         "example.com_p.__T_.M",
+		"p.T.M-fm":                     "p.T.M-fm",
+		"p.(*List[go.shape.int]).Push": "p.__List_go.shape.int__.Push",
+	} {
+		if got := fileName(fn); got != want {
+			t.Errorf("fileName(%q) = %q, want %q", fn, got, want)
+		}
+	}
+}
@@ -15,34 +15,54 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/dr2chase/gossahash/search"
 )
 
 var (
-	hashLimit      int    = 30 // Maximum length of a hash string
-	test_command   string = "./gshs_test.bash"
-	initialSuffix  string = ""           // The initial hash suffix assumed to cause failure.
-	restartSuffix  string = ""           // Restart a search here.
-	restartExclude string = ""           // Exclude these suffixes from search (comma or minus separated).
-	logPrefix      string = "GSHS_LAST_" // Prefix on PASS/FAIL log files.
-	verbose        bool   = false
-	timeout        int    = 900 // Timeout in seconds to apply to command; failure if hit
-	multiple       int    = 1   // Search for this many failures.
-	seed           int64  = time.Now().UnixNano()
-	batchExclude   bool   = false
-	bisectSyntax   bool   = false
+	hashLimit       int     = 30 // Maximum length of a hash string
+	test_command    string  = "./gshs_test.bash"
+	initialSuffix   string  = ""                            // The initial hash suffix assumed to cause failure.
+	restartSuffix   string  = ""                            // Restart a search here.
+	restartExclude  string  = ""                            // Exclude these suffixes from search (comma or minus separated).
+	logPrefix       string  = "GSHS_LAST_"                  // Prefix on PASS/FAIL log files.
+	checkpoint      string  = logPrefix + "checkpoint.json" // Progress of search, for -resume.
+	resume          string  = ""                            // Resume the search checkpointed in this file.
+	jsonReport      string  = ""                            // Write a JSON report of the search to this file.
+	cacheFile       string  = ""                            // Save trial results here, for reuse in later searches.
+	rerun           bool    = false                         // Do not reuse trial results.
+	failRegex       string  = ""                            // Only failures with output matching this count.
+	passRegex       string  = ""                            // Only passes with output matching this count.
+	failExitCodes   string  = ""                            // Only failures with these exit codes count.
+	testsRegex      string  = ""                            // Only failures of go test -json tests matching this count.
+	focus           string  = ""                            // Only failures with signatures containing this count.
+	stageList       string  = ""                            // Search these hash variables in turn (comma-separated).
+	skipExitCode    int     = 125                           // Exit code meaning "cannot tell".
+	artifactDir     string  = ""                            // Save SSA and assembly of the culprits here.
+	artifactGcflags string  = "-S"                          // Compiler flags for collecting artifacts.
+	normalizeStd    bool    = true                          // Also apply the built-in rewrites of trigger lines.
+	verbose         bool    = false
+	timeout         int     = 900 // Timeout in seconds to apply to command; failure if hit
+	multiple        int     = 1   // Search for this many failures.
+	jobs            int     = 1   // Run this many trials at once.
+	lookahead       int     = 0   // Speculate this many extra levels of the search tree.
+	repeat          int     = 1   // Run each configuration this many times and vote.
+	failThreshold   float64 = 0.5 // Fraction of repeated runs that must fail.
+	preflight       bool    = false
+	seed            int64   = 0 // Seed of the search's random choices; 0 means choose one.
+	batchExclude    bool    = false
+	bisectSyntax    bool    = false
+	bisectProtocol  bool    = false
 
 	// Name of the environment variable that contains the hash suffix to be matched against function name hashes.
 	hash_ev_string = "gossahash"
@@ -60,29 +80,14 @@ var (
 	fail bool // If true, converts behavior to a test program
 )
 
-const (
-	FAILED  = iota // Script exited with return code > 0 and multiple functions SSA compiled.
-	DONE           // Script exited with return code > 0 and exactly one function SSA compiled.
-	DONE0          // Script exited with return code > 0 and no functions SSA compiled (means test is flaky)
-	PASSED         // Script exited with return code 0
-	PASSED0        // Script exited with return code 0 AND no functions SSA compiled.
-)
-
-// saveLogFiles stores data in filename, unless it cannot
-// in which case it whines (but still returns).
-// The default permission on the file name is conservative
-// because "you never know".
-func saveLogFile(filename string, data []byte) {
-	error := ioutil.WriteFile(filename, data, 0600)
-	if error != nil {
-		fmt.Fprintf(os.Stderr, "Error saving log file %s\n", error)
-	}
-}
-
 type arg []string
 
 var args arg = arg{test_command} // default value for -h printing, will be discarded.
 
+var normalize arg // REGEX=REPLACEMENT rewrites of trigger lines.
+
+var stopRules arg // REGEX=RESULT rules for stopping trials early.
+
 func (a *arg) String() string {
 	return fmt.Sprintf("%v", *a)
 }
@@ -92,28 +97,6 @@ func (a *arg) Set(value string) error {
 	return nil
 }
 
-var excludes []string // hashes already seen to fail, now excluded
-
-type searchState struct {
-	suffix string
-
-	// The accumulated list of hashes that are either proven
-	// singleton triggers that contribute to failure, or proven/
-	// inferred to trigger at least one SSA-compilation that
-	// contributes to failure.
-	hashes []string
-
-	// hashes before  this index correspond to a single function
-	// whose compilation is necessary to trigger a failure.
-	// This counter advances as new singleton-triggering hashes
-	// are found.
-	next_singleton_hash_index int
-
-	lastTrigger     string
-	lastOutput      []byte
-	withoutExcludes bool // initially, false == "with excludes"
-}
-
 var initialEnvEnvPrefix = "GOCOMPILEDEBUG="
 
 var envEnvPrefix = initialEnvEnvPrefix
@@ -122,289 +105,60 @@ var envEnvPrefix = initialEnvEnvPrefix
 // different sorts of hashing (e.g., full path name vs basename)
 var hashPrefix = ""
 
-var sep = "/"
-
-func (ss *searchState) newStyleEnvString(withExcludes bool) string {
-	ev := fmt.Sprintf("%s%s=%s", envEnvPrefix, hash_ev_string, hashPrefix)
-	if withExcludes {
-		for _, x := range excludes {
-			ev += "-" + x + sep
-		}
-	}
-	ev += ss.suffix
-	for i := 0; i < len(ss.hashes); i++ {
-		ev += fmt.Sprintf("%s%s", sep, ss.hashes[i])
-	}
-	return ev
-}
-
-// tryCmd runs the test command with suffix and all the hashes
-// assigned to environment variables of the form GOSSAHASH and
-// GOSSAHASH%d for [0:len(hashes)-1]
-// If timeout is greater than zero then the command will be
-// killed after that many seconds (to help with bugs that exhibit
-// as an infinite loop), otherwise it runs to completion and the
-// error code and output are captured and returned.
-func (ss *searchState) tryCmd(suffix string) (output []byte, err error) {
-	cmd := exec.Command(test_command)
-	cmd.Args = append(cmd.Args, args...)
-
-	// Fill the env
-	cmd.Env = os.Environ()
-	extraEnv := make([]string, 0)
-
-	if function_selection_logfile != "" {
-		// Create and truncate the file, then inject it into the environment
-		f, _ := os.Create(function_selection_logfile)
-
-		f.Close()
-		ev := fmt.Sprintf("%s=%s", "GSHS_LOGFILE", function_selection_logfile)
-		extraEnv = append(extraEnv, ev)
-	}
-
-	extraEnv = append(extraEnv, ss.newStyleEnvString(!ss.withoutExcludes))
-
-	extraEnv = append(extraEnv, commandLineEnv...)
-
-	cmd.Env = append(cmd.Env, extraEnv...)
-
-	if verbose || true {
-		line := ""
-		for _, e := range extraEnv {
-			line += e
-			line += " "
-		}
-		line += test_command
-		for _, a := range args {
-			line += " "
-			line += a
-		}
-
-		fmt.Fprintf(os.Stdout, "Trying: %s\n", line)
-	} else {
-		if len(extraEnv) == 0 {
-			fmt.Fprintf(os.Stdout, "Trying %s\n", suffix)
-		} else {
-			fmt.Fprintf(os.Stdout, "Trying %s\n", extraEnv)
-		}
-	}
-
-	if timeout == 0 {
-		output, err = cmd.CombinedOutput()
-	} else {
-		var b bytes.Buffer
-		cmd.Stdout = &b
-		cmd.Stderr = &b
-		err = cmd.Start()
-		if err != nil {
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "hash":
+			hashCommand(os.Args[2:])
+			return
+		case "lookup":
+			lookupCommand(os.Args[2:])
 			return
 		}
-		var killErr error
-		var timedOut bool
-		var timeoutMeansPass bool
-		t := timeout
-		if timeout < 0 {
-			timeoutMeansPass = true
-			t = -timeout
-		}
-		doneChan := make(chan int, 1)
-		timer := time.AfterFunc(time.Second*time.Duration(t), func() {
-			timedOut = true
-			p := cmd.Process
-			killErr = p.Signal(os.Interrupt)
-			for i := 0; i < 100; i++ {
-				time.Sleep(time.Millisecond * 250)
-				select {
-				case <-doneChan:
-					return
-				default:
-				}
-			}
-			killErr = p.Signal(os.Kill)
-		})
-		err = cmd.Wait()
-		doneChan <- 1
-		if killErr != nil {
-			// Not sure what I would do with this,
-			// and it could appear merely as the result of a lost race.
-		}
-		timer.Stop()
-		output = b.Bytes()
-		if timedOut {
-			status := "fail"
-			if timeoutMeansPass {
-				err = nil
-				status = "pass"
-			}
-			fmt.Fprintf(os.Stdout, "Timeout after %d seconds (%s): ", t, status)
-		}
-	}
-
-	if verbose {
-		fmt.Fprintf(os.Stdout, "%s", string(output))
-	}
-	return
-}
-
-var hashmatch = regexp.MustCompilePOSIX("[01]+|0x[0-9a-f]+")
-
-// matchTrigger extracts hash trigger reports from the output.
-// repeats are collapsed, but counted in the returned map.  The
-// last match is also returned.
-func matchTrigger(output []byte, hash_ev_name, suffix string) (map[string]int, string) {
-
-	mask := uint64(1)<<len(suffix) - 1
-	suffixVal, _ := strconv.ParseUint(suffix, 2, 64)
-	suffixVal &= mask
-
-	triggerPrefix := hash_ev_name + " triggered"
-	if bisectSyntax {
-		triggerPrefix = "[bisect-match "
-	}
-
-	m := make(map[string]int)
-	var lastTrigger string
-	scanner := bufio.NewScanner(bytes.NewBuffer(output))
-	for scanner.Scan() {
-		s := strings.TrimSpace(scanner.Text())
-		if pi := strings.Index(s, triggerPrefix); pi != -1 {
-			var space int
-			end := -1
-			if bisectSyntax {
-				// [bisect-match 0xabcd]
-				space = strings.LastIndex(s, " ")
-				end = strings.LastIndex(s, "]")
-			}
-			if end == -1 {
-				space = strings.LastIndex(s, " ")
-				end = len(s)
-			}
-
-			if space == -1 {
-				space = len(s)
-				m[s] = m[s] + 1
-			} else {
-				h := strings.TrimSpace(s[space:end])
-				if ss := hashmatch.FindStringSubmatch(h); len(ss) == 1 && ss[0] == h {
-					if bisectSyntax {
-						// Suffix must match
-						hv, err := strconv.ParseUint(h[2:], 16, 64)
-						if err == nil {
-							if hv&mask != suffixVal {
-								continue
-							}
-							m[h] = m[h] + 1
-						} else {
-							panic(fmt.Errorf("Failed to parse %s, error %v", h[2:], err))
-						}
-					} else {
-						m[h] = m[h] + 1
-					}
-				} else {
-					m[s] = m[s] + 1
-				}
-			}
-			if bisectSyntax {
-				lastTrigger = strings.TrimSpace(s[0:pi])
-			} else {
-				lastTrigger = strings.TrimSpace(s[len(triggerPrefix):space])
-			}
-
-		}
-	}
-	return m, lastTrigger
-}
-
-func parseExcludes(x string) []string {
-	if x == "" {
-		return nil
-	}
-	var xs []string
-	var a string
-	for _, c := range x {
-		switch c {
-		case '0', '1':
-			a = a + string(c)
-		case ' ', ',', '-', '+':
-			if len(a) > 0 {
-				xs = append(xs, a)
-				a = ""
-			}
-		}
-	}
-	if len(a) > 0 {
-		xs = append(xs, a)
-	}
-	return xs
-}
-
-// trySuffix runs the test command passing it suffix as an argument,
-// and returns PASSED/FAILED/DONE/DONE0 based on return code and occurrences
-// of the function_selection_string within the output; if there is only
-// one and the command fails, then the search is done.
-// Appropriate log files and narrative are also produced.
-func (ss *searchState) trySuffix(suffix string) (int, []byte) {
-	ss.suffix = suffix
-	output, error := ss.tryCmd(suffix)
-
-	if function_selection_logfile != "" {
-		outputf, errorf := ioutil.ReadFile(function_selection_logfile)
-		if errorf == nil {
-			output = outputf
-		}
-	}
-
-	// Compilations sometimes occur more than once, so stuff the
-	// matching string into a map. Note the map contains the whole
-	// line, so varying output not included in the hash can prevent
-	// convergence on a single trigger line.
-
-	var m map[string]int
-	m, ss.lastTrigger = matchTrigger(output, hash_ev_name, suffix)
-	count := len(m)
-
-	// (error == nil) means success
-	prefix := ""
-
-	if error != nil {
-		why := error.Error()
-		// we like errors.
-		fmt.Fprintf(os.Stdout, "%s %sfailed (%d distinct triggers): %s\n", test_command, prefix, count, why)
-		lfn := fmt.Sprintf("%s%sFAIL.%d.log", logPrefix, prefix, ss.next_singleton_hash_index)
-		// lfn = filepath.Join(tmpdir, lfn)
-		saveLogFile(lfn, output)
-		if count <= 1 {
-			fmt.Fprintf(os.Stdout, "Review %s for %sfailing run\n", lfn, prefix)
-			if count == 0 {
-				return DONE0, output
-			}
-			return DONE, output
-		}
-		return FAILED, output
 	}
-	saveLogFile(logPrefix+prefix+"PASS.log", output)
-	if count == 0 {
-		return PASSED0, output
-	}
-	return PASSED, output
-}
 
-func main() {
 	fma := false
 	loopvar := false
 
 	flag.BoolVar(&batchExclude, "BX", batchExclude, "for repeated multi-point failure search, exclude all points on failure location")
 	flag.StringVar(&initialEnvEnvPrefix, "E", initialEnvEnvPrefix, "prefix string for environment-encoded variables, e.g., GOCOMPILEDEBUG= or GODEBUG=")
 	flag.BoolVar(&fail, "F", fail, "act as a test program.  Generates multiple multipoint failures.")
+	flag.StringVar(&modelFile, "model", modelFile, "with -F, read the failure model from this file")
+	flag.StringVar(&modelSpec, "model-spec", modelSpec, "with -F, the failure model, with ';' separating lines, e.g., 'fail 2 of ant,bat and gnu;flake 0.1'")
 	flag.StringVar(&hashPrefix, "H", hashPrefix, "string prepended to all hash encodings, for special hash interpretation/debugging")
 	flag.StringVar(&restartSuffix, "R", restartSuffix, "begin searching at this suffix, it should known-fail for this suffix[1:]")
 	flag.StringVar(&restartExclude, "X", restartExclude, "exclude these suffixes from matching")
 	flag.BoolVar(&bisectSyntax, "B", bisectSyntax, "use bisect syntax for matches")
+	flag.BoolVar(&bisectProtocol, "bisect", bisectProtocol, "use the bisect protocol: bisect patterns (v, y/n, +/- lists) in the environment, and bisect match markers (implies -B)")
 
 	flag.StringVar(&hash_ev_string, "e", hash_ev_string, "name/prefix of variable communicating hash suffix")
+	flag.StringVar(&stageList, "stages", stageList, "search these (comma-separated) hash variables in turn, each within the failure found by the ones before, e.g., pkghash,gossahash,poshash")
 	flag.BoolVar(&function_selection_use_file, "f", function_selection_use_file, "if set, use a file instead of standard out for hash trigger information")
 	flag.BoolVar(&fma, "fma", fma, "search for fused-multiply-add floating point rounding problems (for arm64, ppc64, s390x)")
 	flag.BoolVar(&loopvar, "loopvar", loopvar, "search for loopvar-dependent failures")
+	flag.IntVar(&jobs, "j", jobs, "run up to this many trials at once, trying both arms of each search step speculatively")
+	flag.IntVar(&lookahead, "lookahead", lookahead, "with -j, also speculate this many further levels of the search tree")
+	flag.IntVar(&repeat, "repeat", repeat, "run each configuration this many times, and decide pass/fail by vote (for flaky tests)")
+	flag.Float64Var(&failThreshold, "fail-threshold", failThreshold, "with -repeat, fraction of runs that must fail for a configuration to fail")
+	flag.StringVar(&checkpoint, "checkpoint", checkpoint, "write the progress of the search to this file after every trial (empty for none)")
+	flag.StringVar(&resume, "resume", resume, "resume the search checkpointed in this file, with its original command line")
+	flag.StringVar(&jsonReport, "json", jsonReport, "write a machine-readable (JSON) report of the failures found to this file")
+	flag.StringVar(&cacheFile, "cache", cacheFile, "remember trial results in this file, and reuse them in later searches")
+	flag.BoolVar(&rerun, "rerun", rerun, "always run trials, never reuse an earlier result of the same configuration (for flaky tests)")
+	flag.StringVar(&failRegex, "fail-regex", failRegex, "only failures whose output matches this regular expression count as failures; others are unrelated")
+	flag.StringVar(&passRegex, "pass-regex", passRegex, "only passes whose output matches this regular expression count as passes; others are unrelated")
+	flag.StringVar(&failExitCodes, "fail-exit-codes", failExitCodes, "only failures with one of these (comma-separated) exit codes count as failures; others are unrelated")
+	flag.StringVar(&testsRegex, "tests", testsRegex, "the command runs go test -json, and only failures of tests whose names match this regular expression count as failures; other tests may fail")
+	flag.StringVar(&focus, "focus", focus, "only failures whose signature (crash, failing tests, exit status) contains this string count as failures; others count as passes")
+	flag.IntVar(&skipExitCode, "skip-exit-code", skipExitCode, "exit code with which the test command says it cannot tell whether the failure occurred (0 for none)")
+	flag.StringVar(&artifactDir, "collect-artifacts", artifactDir, "after the search, rerun the failing and passing configurations, saving ssa.html and assembly of the culprit function in this directory")
+	flag.StringVar(&artifactGcflags, "artifact-gcflags", artifactGcflags, "with -collect-artifacts, compiler flags passed to the command as GOFLAGS=-gcflags=...")
+	flag.IntVar(&hashLimit, "hashlen", hashLimit, "maximum length of the hash suffix, in bits (at most 64)")
+	flag.Var(&normalize, "normalize", "before counting distinct trigger lines, replace text matching REGEX with REPLACEMENT, written REGEX=REPLACEMENT (repeatable)")
+	flag.BoolVar(&normalizeStd, "normalize-builtin", normalizeStd, "also normalize go build work directories to $WORK/ and process IDs to pid=N in trigger lines")
+	flag.BoolVar(&preflight, "preflight", preflight, "before searching, check that the test fails with everything enabled, passes with nothing enabled (pattern n), and reports triggers")
+	flag.Int64Var(&seed, "seed", seed, "seed for the search's random choices, to repeat an earlier search (0 means choose one)")
+	flag.Var(&stopRules, "stop", "stop a trial as soon as a line of its output matches REGEX, written REGEX=fail, REGEX=pass, or REGEX=untriggered (pass if nothing was triggered yet) (repeatable)")
 	flag.IntVar(&multiple, "n", multiple, "stop after finding this many failures (0 for don't stop)")
 	flag.IntVar(&timeout, "t", timeout, "timeout in seconds for running test script, 0=run till done. Negative timeout means timing out is a pass, not a failure")
 	flag.BoolVar(&verbose, "v", verbose, "also print output of test script (default false)")
@@ -451,17 +205,191 @@ that are debugged using GSHS_LOGFILE should open it in append
 mode, not truncate, since they may have been preceded by some
 other phase of the build or test.
 
+By default, a trial fails if the command exits with a non-zero
+status.  To keep the search from converging on some other breakage,
+-fail-regex, -pass-regex and -fail-exit-codes describe the failure
+being searched for; a trial that fails (or passes) without matching
+them is an unrelated failure, which is reported, but not searched.
+
+For a command that runs go test -json, -tests=REGEX defines failure
+as the failure of a test whose name matches REGEX, so that one test
+can be searched for even if others are broken, whatever the exit
+status; -fail-regex, -pass-regex and -fail-exit-codes do not apply.
+If no such test runs (for instance, because the build broke), the
+failure is unrelated.  The tests that fail with the culprit, and
+with nothing enabled, are listed at the end, e.g.
+
+	gossahash -tests='^TestForwardCopy$' go test -json -run TestForwardCopy
+
+Each failure found has a signature, made of its crash signature (the
+panic or fatal error message and top non-runtime functions, or the
+compiler's internal error), its failing tests (with -tests), and its
+exit status.  At the end of a search with -n, failures are grouped by
+signature, since failures with the same signature are probably one
+bug in several places, and failures with different signatures are
+probably different bugs.  To search for one of them, -focus=STRING
+counts only failures whose signature contains STRING, and other
+failures count as passes, e.g.
+
+	gossahash -n=0 -focus='index out of range' ./all.bash
+
+Since another bug can mask the one being searched for, the suggested
+-focus for each group comes with a -X excluding the failures of the
+other groups.
+
+Long-running tests need not run to the end once their outcome is
+known.  Each -stop=REGEX=RESULT rule (there may be several) watches the
+command's output as it runs, and as soon as a line matches REGEX, the
+trial is stopped with RESULT: fail, pass, or untriggered, which passes
+if nothing has been triggered yet (for instance, when a build reaches
+a step after all the code that the hash could affect), e.g.
+
+	gossahash -stop='^--- FAIL=fail' -stop='^# linking=untriggered' ./all.bash
+
+Since the search counts the distinct triggers of each trial, a fail
+rule stops a trial only once two triggers have been reported, and a
+pass rule once one has; until then, the command runs to the end, but
+the rule still decides the outcome.
+
+Like git bisect, a test command can exit with status 125 (see
+-skip-exit-code) to say that it cannot tell whether the failure
+occurred, for example because the hash configuration broke the build
+in some other way.  The search then presumes that the failure lies in
+the untested half, continuing with longer suffixes, and backtracks if
+that proves to be a dead end.  A single trigger that cannot be tested
+is excluded, and if nothing else is left untested, the search starts
+over without it, in case it hid one half of a failure that needs two
+or more triggers.
+
+The -B flag expects trigger lines in the syntax of the bisect tool
+(golang.org/x/tools/cmd/bisect), i.e., containing a match marker
+'[bisect-match 0x...]', optionally preceded by a description.  The
+-bisect flag also passes the hash suffixes as bisect patterns (for
+example, v0110+1011-0001), so that gossahash can drive any program
+instrumented with golang.org/x/tools/internal/bisect, or the runtime's
+GODEBUG bisection, e.g.
+
+	gossahash -bisect -E GODEBUG= -e asynctimerchan -H '1#' go test
+
+Each trial runs in its own process group.  When a trial times out
+(-t) the whole group is interrupted, so that children such as
+compilers and test binaries stop too, and any processes still running
+25 seconds later are killed and reported.
+
+With -preflight, before searching, gossahash checks that the test fails
+with everything enabled, passes with nothing enabled (pattern "n",
+which the program's hash matching must understand), and reports
+triggers, and explains what is wrong if not.  The checks cost two
+trials, so they are off by default.
+
+The -j flag runs up to that many trials at once.  Both arms of each
+step of the search (0xyz and 1xyz) are tried at the same time, and
+-lookahead=N also tries N more levels of the search tree beneath
+them; trials that become irrelevant are killed.  Each worker gets its
+own TMPDIR and its own GSHS_LOGFILE.
+
+Flaky tests can be run several times for each configuration with
+-repeat=N, and a configuration fails if at least the -fail-threshold
+fraction of its runs fail.  If a single run could change the outcome
+of the vote, up to 2N runs are made.  Configurations that both passed
+and failed are listed, with their failure rate, at the end.
+
+Trigger lines that differ only in text that varies from run to run
+would keep the search from converging on a single trigger, so before
+distinct triggers are counted, go build work directories (e.g.,
+/tmp/go-build123456/) are replaced by $WORK/, and process IDs by pid=N
+(unless -normalize-builtin=false), and -normalize=REGEX=REPLACEMENT
+rewrites other text, e.g., -normalize='\.tmp[0-9]+=.tmpN'.
+
+The -collect-artifacts=dir flag reruns, after the search, each
+failing configuration and the configuration with no hashes enabled
+("n", which should pass), with GOSSAFUNC set to the culprit function,
+GOSSADIR set to dir/fail or dir/pass, and GOFLAGS=-gcflags=-S (see
+-artifact-gcflags; e.g., use all=-S for packages not named on the
+command line).  The compiler's ssa.html, the command's output, and the
+culprit's assembly are saved there, along with a diff of the assembly.
+
+A search stops at suffixes of -hashlen bits (default 30); big programs
+with many trigger points (e.g., inlined positions with -loopvar) may
+need more, up to 64.  If a suffix fails with a single hash that is
+reported for several distinct names (a hash collision), those names
+are reported together as a collision group, since no longer suffix
+can separate them.
+
+A big search can be narrowed down in stages, with -stages naming a
+hash variable for each, for instance for the package, the function,
+and the source position of a bug.  The first stage searches its
+variable alone; each later stage searches its variable with the
+settings found by the earlier ones added to the environment, so that
+the program, which must apply a change only where all of the
+variables match, applies it only within the failure already found,
+e.g.
+
+	gossahash -stages=pkghash,gossahash,poshash ./make.bash
+
+runs GOCOMPILEDEBUG=pkghash=1101,gossahash=0110 ./make.bash, and so
+on.  The failure found at each stage is reported, and then the
+combined setting, with the triggers of all the stages.
+
 Searches can be restarted or parallel searches can be managed
 using the -R and -X flags.  -R 1yz assumes that yz is known to
 fail, will start at 1yz, and if that does not fail, will try
 0yz.  -X takes a list (space, comma, +, or - separated) of binary
 suffixes to exclude from the restarted search.
 
+The search chooses at random which arm of each step to try first,
+and which hash of a multiple-point failure to search next.  The seed
+of these choices is printed at the start and end of the search and
+in reports, and -seed repeats the choices of an earlier search.
+
+The -json=file flag writes a machine-readable report of the failures
+found, including their hashes, trigger lines, positions, suggested
+GOSSAFUNC, and the environment and command that reproduce them.
+
+The result of each trial is remembered, and a configuration that
+has already been tried is not run again, unless -rerun is set (for
+flaky tests).  With -cache=file, results are saved in that file and
+reused by later searches with the same command.
+
+After every trial, the progress of the search is written to the
+-checkpoint file (default GSHS_LAST_checkpoint.json).  An interrupted
+search can be continued with -resume=file; the checkpointed trials
+are replayed, using the original command line and random seed, so the
+search continues exactly where it left off.
+
+To preview the steps of a search, "gossahash hash" prints the hashes
+(and the low -hashlen bits, as a suffix) of names, and "gossahash
+lookup SUFFIX" lists the names that a suffix, or a whole setting such
+as 0001010/1100000110 or GOCOMPILEDEBUG=gossahash=-01/110, matches.
+The names are given as arguments, or with -file (one per line), -nm
+(the functions of a binary, as listed by go tool nm), -src (the
+functions declared in a Go source file or directory, qualified by
+-pkg), or -F (the names of the -F test program), e.g.
+
+	gossahash lookup -src ./ssa -pkg cmd/compile/internal/ssa 0001010
+
 The %s command can be run as its own test with the -F flag, as in
 (prints about 100 long lines, and demonstrates multi-point failure detection):
 
   %s %s -F 
 
+The failure of -F is described by a model, given in a file with
+-model or inline with -model-spec (with ';' separating lines):
+
+	fail FORMULA   fail when FORMULA holds; several fail lines are OR'd
+	flake P        a failing run passes anyway with probability P
+	hang           hang (until killed) instead of failing
+	crash          panic instead of failing, naming the fail line that held
+	logfile        report triggers and failure only in GSHS_LOGFILE
+	pos            report triggers as POS= positions, as -loopvar does
+
+A FORMULA is terms joined by "and"; a term is "K of SET", "all of SET",
+"any of SET", or a single name, and a SET is a comma-separated list of
+names, "len=N" (names of length N), or "*".  The default model is
+"fail 4 of len=3".  For example,
+
+  %s -f %s -F -model-spec 'fail 2 of ant,bat;fail all of cat,dog;logfile'
+
 The -BX flag controls treatment of overlapping multiple-point errors.
 By default, 'gossahash -n=6 gossahash -F' will find 5 failures, but
 with sets of hash matches that overlap (i.e., '1101000' appears 4 times)
@@ -485,22 +413,55 @@ GOSSAFUNC='dog' GOCOMPILEDEBUG=gossahash=0001010/1100000110/010100010/0000010 go
 FINISHED, after filtering, suggest this command line for debugging:
 GOSSAFUNC='hen' GOCOMPILEDEBUG=gossahash=1011101100/0110101001/1101000/10001101 gossahash -F
 `,
-			os.Args[0], hash_ev_string, os.Args[0], os.Args[0], os.Args[0])
+			os.Args[0], hash_ev_string, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 	}
 
 	flag.Parse()
 
+	commandLine := os.Args
+	var resumed *search.Checkpoint
+	if resume != "" {
+		c, err := search.ReadCheckpoint(resume)
+		if err != nil {
+			fmt.Printf("Cannot resume: %v\n", err)
+			os.Exit(1)
+		}
+		// Continue with the command line and seed of the interrupted search.
+		commandLine = c.CommandLine
+		if err := flag.CommandLine.Parse(commandLine[1:]); err != nil {
+			os.Exit(2)
+		}
+		seed = c.Seed
+		resumed = c
+		fmt.Printf("Resuming %s, replaying %d trials\n", strings.Join(commandLine, " "), len(c.Trials))
+	}
+
 	// Choose differently each time run to make it easier
 	// to search for multiple failures; perhaps one is
 	// substantially easier to debug in isolation.
-	// TODO print this and also take it as a parameter; use it for the logfile name.
-	rand.Seed(seed)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	if bisectProtocol {
+		bisectSyntax = true
+	}
 
 	if fma && loopvar {
 		fmt.Printf("Cannot set both -fma and -loopvar")
 		os.Exit(1)
 	}
 
+	if stageList != "" && (restartSuffix != "" || restartExclude != "" || resumed != nil || artifactDir != "") {
+		fmt.Printf("-stages cannot be combined with -R, -X, -resume, or -collect-artifacts\n")
+		os.Exit(1)
+	}
+
+	if hashLimit < 1 || hashLimit > 64 {
+		fmt.Printf("-hashlen must be between 1 and 64, not %d\n", hashLimit)
+		os.Exit(1)
+	}
+
 	if fma {
 		hash_ev_string = "fmahash"
 	}
@@ -542,8 +503,6 @@ GOSSAFUNC='hen' GOCOMPILEDEBUG=gossahash=1011101100/0110101001/1101000/10001101
 		}
 	}
 
-	excludes = parseExcludes(restartExclude)
-
 	restArgs := flag.Args()
 	var firstNotEnv int
 	var arg string
@@ -576,258 +535,322 @@ GOSSAFUNC='hen' GOCOMPILEDEBUG=gossahash=1011101100/0110101001/1101000/10001101
 		args = args[1:]
 	}
 
-	sss := []*searchState{}
-	ss := &searchState{}
-	if restartSuffix != "" {
-		initialSuffix = restartSuffix[1:]
-		restartSuffix = restartSuffix[:1]
+	oracle := &search.CommandOracle{
+		Command: test_command,
+		Args:    args,
+		Env:     commandLineEnv,
+		Timeout: timeout,
+		LogFile: function_selection_logfile,
+		Verbose: verbose,
+
+		SkipExitCode: skipExitCode,
 	}
-	for {
-		if !ss.search(initialSuffix, restartSuffix) {
-			fmt.Printf("FLAKY TEST OR BAD SEARCH\n")
-			break
-		} else {
-			sss = append(sss, ss)
-			// clean up multiple hash matches; this gives better output,
-			// also makes excludes more precise when reporting multiple errors.
-			ss.withoutExcludes = true
-			ss.filter()
-
-			multiple--
-			if multiple == 0 {
-				break
-			}
-			excludes = append(excludes, ss.suffix)
-			if batchExclude {
-				excludes = append(excludes, ss.hashes...)
-			}
-			ss = &searchState{}
-			result, _ := ss.trySuffix(initialSuffix)
-			if result == PASSED || result == PASSED0 {
-				fmt.Printf("NO MORE FAILURES\n")
-				break
-			}
+	if jobs > 1 {
+		oracle.TmpDir = tmpdir
+	}
+	if failRegex != "" {
+		oracle.FailRegexp = mustCompile("-fail-regex", failRegex)
+	}
+	if passRegex != "" {
+		oracle.PassRegexp = mustCompile("-pass-regex", passRegex)
+	}
+	if testsRegex != "" {
+		if failRegex != "" || passRegex != "" || failExitCodes != "" {
+			fmt.Printf("-tests cannot be combined with -fail-regex, -pass-regex, or -fail-exit-codes\n")
+			os.Exit(1)
 		}
+		oracle.Tests = mustCompile("-tests", testsRegex)
 	}
-
-	excludes = nil
-
-	for _, ss := range sss {
-		ss.finish()
+	for _, x := range strings.Split(failExitCodes, ",") {
+		if x = strings.TrimSpace(x); x == "" {
+			continue
+		}
+		code, err := strconv.Atoi(x)
+		if err != nil {
+			fmt.Printf("Bad exit code %q in -fail-exit-codes\n", x)
+			os.Exit(1)
+		}
+		oracle.FailExitCodes = append(oracle.FailExitCodes, code)
+	}
+	var rewrites []search.Rewrite
+	if normalizeStd {
+		rewrites = append(rewrites, search.DefaultRewrites...)
+	}
+	for _, n := range normalize {
+		r, err := search.ParseRewrite(n)
+		if err != nil {
+			fmt.Printf("Bad -normalize: %v\n", err)
+			os.Exit(1)
+		}
+		rewrites = append(rewrites, r)
+	}
+	for _, x := range stopRules {
+		r, err := search.ParseStopRule(x)
+		if err != nil {
+			fmt.Printf("Bad -stop: %v\n", err)
+			os.Exit(1)
+		}
+		oracle.Stop = append(oracle.Stop, r)
+	}
+	cache, err := search.NewCache(cacheFile)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
 	}
-}
 
-func printCL() {
-	for _, e := range commandLineEnv {
-		fmt.Printf(" %s", e)
+	opts := search.Options{
+		EnvPrefix:     envEnvPrefix,
+		HashVar:       hash_ev_string,
+		HashPrefix:    hashPrefix,
+		HashLimit:     hashLimit,
+		Excludes:      search.ParseExcludes(restartExclude),
+		Multiple:      multiple,
+		BatchExclude:  batchExclude,
+		Bisect:        bisectSyntax,
+		Normalize:     rewrites,
+		BisectPattern: bisectProtocol,
+		Jobs:          jobs,
+		Lookahead:     lookahead,
+		Repeat:        repeat,
+		FailThreshold: failThreshold,
+		LogPrefix:     logPrefix,
+		Checkpoint:    checkpoint,
+		CommandLine:   commandLine,
+		Seed:          seed,
+		Resume:        resumed,
+		Cache:         cache,
+		CacheKey:      oracle.CacheKey(),
+		Rerun:         rerun,
+		Focus:         focus,
+	}
+
+	if stageList != "" {
+		searchStages(oracle, opts, strings.Split(stageList, ","), commandLine)
+		return
 	}
-	fmt.Printf(" %s", test_command)
-	for _, e := range args {
-		fmt.Printf(" %s", e)
+
+	searcher := search.New(oracle, opts)
+	if preflight && resumed == nil {
+		checkPreflight(searcher, envEnvPrefix)
 	}
-}
 
-func (ss *searchState) filter() {
-	if len(ss.hashes) > 0 {
-		// Because the tests can be flaky, see if we accidentally included hashes that aren't
-		// really necessary.  This is a boring mechanical task that computers excel at...
+	fmt.Printf("Searching with -seed=%d\n", seed)
+	start := time.Now()
+	sss := searcher.Run(initialSuffix, restartSuffix)
 
-		fmt.Printf("Before filtering, multiple hashes required for failure:\n%s=%s", hash_ev_name, ss.suffix)
-		for i, h := range ss.hashes {
-			fmt.Printf(" %s%d=%s", hash_ev_name, i, h)
+	for _, ss := range sss {
+		finish(ss, oracle)
+		if oracle.Tests != nil {
+			finishTests(ss, searcher.Baseline())
 		}
-		fmt.Println()
-
-		// Next filter the hashes to see if any can be excluded:
-		temporarily_removed := ss.hashes[len(ss.hashes)-1]
-		ss.hashes = ss.hashes[0 : len(ss.hashes)-1]
-		// suffix is initially the last value of GOSSAHASH
-		var result int
-
-		for i := len(ss.hashes); i >= -1 && len(ss.hashes) > 0; i-- {
-			// Special values for search:
-			// hashes[len(hashes)] == temporarily_removed,
-			// hashes[-1] == suffix
-			t := temporarily_removed
-			if i == -1 {
-				temporarily_removed = ss.suffix
-				ss.suffix = t
-			} else if i < len(ss.hashes) {
-				temporarily_removed = ss.hashes[i]
-				ss.hashes[i] = t
-			}
-			result, _ = ss.trySuffix(ss.suffix)
-			switch result {
-			case DONE0: // failed but GOSSAHASH triggered nothing
-				// needed neither GOSSAHASH nor the excluded one.
-				if len(ss.hashes) > 1 { // cannot be zero, see loop condition.
-					temporarily_removed = ""
-					ss.suffix = ss.hashes[len(ss.hashes)-1]
-					ss.hashes = nil // exit with only suffix
-				} else {
-					ss.suffix = ss.hashes[len(ss.hashes)-1]
-					temporarily_removed = ss.hashes[len(ss.hashes)-2]
-					ss.hashes = ss.hashes[0 : len(ss.hashes)-2]
-				}
-			case DONE, FAILED: // ought not see failed, but never mind.
-				temporarily_removed = ss.hashes[len(ss.hashes)-1]
-				ss.hashes = ss.hashes[0 : len(ss.hashes)-1]
+	}
+
+	if len(sss) > 1 {
+		printClusters(sss, oracle)
+	}
+
+	if artifactDir != "" {
+		for i, ss := range sss {
+			dir := artifactDir
+			if len(sss) > 1 {
+				dir = filepath.Join(dir, strconv.Itoa(i))
 			}
+			collectArtifacts(dir, ss, oracle)
 		}
-		if temporarily_removed != "" {
-			ss.hashes = append(ss.hashes, temporarily_removed)
+	}
+
+	printTrouble(searcher)
+	fmt.Printf("Searched with -seed=%d\n", seed)
+
+	if jsonReport != "" {
+		r := newReport(searcher, sss, oracle, commandLine, start)
+		if err := r.write(jsonReport); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON report %s\n", err)
 		}
+	}
+}
 
-		fmt.Printf("Confirming filtered hash set triggers failure:\n")
-		_, ss.lastOutput = ss.trySuffix(ss.suffix)
-	} else {
-		fmt.Printf("Not filtering, single point failure\n")
+// checkPreflight runs the preflight checks of searcher, whose hash
+// variable is set with envPrefix, and exits, explaining what is wrong,
+// if they fail.
+func checkPreflight(searcher *search.Searcher, envPrefix string) {
+	err := searcher.Preflight(initialSuffix)
+	if err == nil {
+		return
 	}
+	fmt.Printf("Preflight failed: %v\n", err)
+	if errors.Is(err, search.ErrNoTriggers) && function_selection_use_file {
+		fmt.Printf("With -f, triggers are read from GSHS_LOGFILE, which the test must append to\n")
+	} else if errors.Is(err, search.ErrNoTriggers) || errors.Is(err, search.ErrPassesWithAll) {
+		fmt.Printf("Check that %s reaches the program (see -E), and that its triggers are named %s (see -e)\n", envPrefix+hash_ev_string, hash_ev_name)
+	}
+	fmt.Printf("Omit -preflight to search anyway\n")
+	os.Exit(1)
 }
 
-func (ss *searchState) finish() {
-	printGSF := func() {
-		if ss.lastTrigger != "" && !strings.HasPrefix(ss.lastTrigger, "POS=") {
-			ci := strings.Index(ss.lastTrigger, ":")
-			if ci == -1 {
-				ci = len(ss.lastTrigger)
-			}
-			fmt.Printf("GOSSAFUNC='%s' ", ss.lastTrigger[:ci])
+// printTrouble lists the flaky configurations and unrelated failures
+// seen by searcher.
+func printTrouble(searcher *search.Searcher) {
+	if flakes := searcher.Flakes(); len(flakes) > 0 {
+		fmt.Printf("Observed flake rates:\n")
+		for _, f := range flakes {
+			fmt.Printf("\tsuffix %s failed %d of %d runs (%.0f%%): %s\n", f.Suffix, f.Fails, f.Runs, 100*f.Rate(), f.Env)
 		}
 	}
 
-	printPOS := func(lastTrigger, intro string) {
-		posPfx := "POS="
-		if strings.HasPrefix(lastTrigger, posPfx) {
-			inlineLocs := strings.Split(lastTrigger[len(posPfx):], ";")
-			if len(inlineLocs) == 1 {
-				fmt.Printf("%s %s\n", intro, inlineLocs[0])
-			} else if len(inlineLocs) > 1 {
-				fmt.Printf("%s:\n", intro)
-				sfx := ""
-				for _, l := range inlineLocs {
-					fmt.Printf("\t%s%s\n", l, sfx)
-					sfx = " (inlined function)"
-				}
-			}
+	if unrelated := searcher.Unrelated(); len(unrelated) > 0 {
+		fmt.Printf("Unrelated failures (not searched):\n")
+		for _, r := range unrelated {
+			fmt.Printf("\t%s: %s\n", r.Env, r.Outcome.Why)
 		}
+	}
+}
 
+// mustCompile compiles the regular expression re, supplied by flag,
+// or exits.
+func mustCompile(flag, re string) *regexp.Regexp {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		fmt.Printf("Bad regular expression for %s: %v\n", flag, err)
+		os.Exit(1)
 	}
+	return r
+}
 
-	if len(ss.hashes) == 0 {
-		fmt.Printf("FINISHED, suggest this command line for debugging:\n")
-		printGSF()
-		fmt.Printf("%s", ss.newStyleEnvString(false))
-		printCL()
-		fmt.Println()
-		printPOS(ss.lastTrigger, "Problem is at")
-	} else {
-		fmt.Printf("FINISHED, after filtering, suggest this command line for debugging:\n")
+// gossafunc returns the function name in trigger, suitable for
+// GOSSAFUNC, or "" if there is none.
+func gossafunc(trigger string) string {
+	if trigger == "" || strings.HasPrefix(trigger, "POS=") {
+		return ""
+	}
+	ci := strings.Index(trigger, ":")
+	if ci == -1 {
+		ci = len(trigger)
+	}
+	return trigger[:ci]
+}
 
-		printGSF()
-		fmt.Printf("%s", ss.newStyleEnvString(false))
-		printCL()
-		fmt.Println()
-
-		output := ss.lastOutput
-		_, trigger := matchTrigger(output, hash_ev_name, ss.suffix)
-		printPOS(trigger, "Problem is at")
-		for i, s := range ss.hashes {
-			_, trigger = matchTrigger(output, fmt.Sprintf("%s%d", hash_ev_name, i), s)
-			printPOS(trigger, "and")
-		}
+// inlineLocations returns the positions in a POS= trigger; the first
+// is the position of the problem, and any others are the positions of
+// the functions it was inlined into.
+func inlineLocations(trigger string) []string {
+	posPfx := "POS="
+	if !strings.HasPrefix(trigger, posPfx) {
+		return nil
 	}
+	return strings.Split(trigger[len(posPfx):], ";")
 }
 
-func (ss *searchState) search(confirmed_suffix, restart_suffix string) bool {
-	// confirmed_suffix is a suffix that is confirmed
-	// to contain a failure.  The first confirmation is
-	// assumed to have occurred externally before this
-	// program was run.
-	for len(confirmed_suffix) < hashLimit {
-		a := "0"
-		b := "1"
-
-		if restart_suffix == "" && 0 == 8192&rand.Int() || restart_suffix == "1" {
-			a, b = b, a
-			restart_suffix = ""
-		}
-		first_result, _ := ss.trySuffix(a + confirmed_suffix)
-		switch first_result {
-		case FAILED:
-			// Suffix is confirmed to contain a failure,
-			// but there is more than one match (function compiled)
-			// Record this confirmation and continue the search.
-			confirmed_suffix = ss.suffix
-			continue
+// A hashTrigger is the last trigger for one of the hashes of a failure.
+type hashTrigger struct {
+	Var     string // Hash variable name, e.g., gossahash or gossahash0
+	Hash    string
+	Trigger string
+}
 
-		case PASSED0:
-		case PASSED:
-			// Suffix does not trigger a failure, so try
-			// prepending a "1" instead, below.
-		case DONE0:
-			// Treat this like a "pass" -- this hashcode is not useful for failure.
-
-		case DONE:
-			// suffix caused exactly one function to be optimized
-			// and the test also failed.
-			if ss.next_singleton_hash_index == len(ss.hashes) {
-				// In this case all confirmed searches have yielded
-				// singleton instances and we are done.
-				return true
-			}
-			// record this discovery and move on to the next one.
-			confirmed_suffix = ss.hashes[ss.next_singleton_hash_index]
-			ss.hashes[ss.next_singleton_hash_index] = ss.suffix
-			ss.next_singleton_hash_index++
-			continue
+// hashTriggers returns the triggers for the suffix and each hash of ss.
+func hashTriggers(ss *search.State) []hashTrigger {
+	if len(ss.Hashes) == 0 {
+		return []hashTrigger{{hash_ev_name, ss.Suffix, ss.LastTrigger}}
+	}
+	hts := []hashTrigger{{hash_ev_name, ss.Suffix, ss.LastTrigger}}
+	for i, s := range ss.Hashes {
+		trigger := ""
+		if i < len(ss.HashTriggers) {
+			trigger = ss.HashTriggers[i]
 		}
+		hts = append(hts, hashTrigger{fmt.Sprintf("%s%d", hash_ev_name, i), s, trigger})
+	}
+	return hts
+}
 
-		// The a arm contained no failures, try the b arm.
-		result, _ := ss.trySuffix(b + confirmed_suffix)
-		switch result {
-		case FAILED:
-			confirmed_suffix = ss.suffix
-			continue
-		case PASSED:
-			if first_result == PASSED {
-				fmt.Fprintf(os.Stdout, "Both trials unexpectedly succeeded\n")
-				// 0xyz and 1xyz both succeeded alone, but xyz failed.
-				// Failure therefore requires at least 2 hits, one in
-				// 0xyz and one in 1xyz.  Therefore, put 1xyz in the set
-				// of confirmed (i.e., contains a non-isolated failure)
-				// mark 0xyz as confirmed for local search, and continue.
-				if 0 == 8192&rand.Int() {
-					a, b = b, a
+// printClusters lists the failures in sss, grouped by signature.
+func printClusters(sss []*search.State, oracle *search.CommandOracle) {
+	cs := search.Clusters(sss)
+	fmt.Printf("%d failures, with %d distinct signatures:\n", len(sss), len(cs))
+	for _, c := range cs {
+		sig := c.Signature
+		if sig == "" {
+			sig = "(unknown)"
+		}
+		fmt.Printf("%d with signature %s\n", len(c.States), sig)
+		if c.Signature != "" && len(cs) > 1 {
+			var others []string
+			for _, o := range cs {
+				if o != c {
+					for _, ss := range o.States {
+						others = append(others, ss.Suffix)
+					}
 				}
-				ss.hashes = append(ss.hashes, b+confirmed_suffix)
-				confirmed_suffix = a + confirmed_suffix
-				continue
 			}
-			fallthrough
+			fmt.Printf("\tsearch these alone with -focus='%s' -X=%s\n", c.Signature, strings.Join(others, ","))
+		}
+		for _, ss := range c.States {
+			fmt.Printf("\t%s %s\n", ss.Env(false), oracle.CommandLine())
+		}
+	}
+}
+
+// finishTests lists the tests that fail with the failure ss, and
+// those that fail with nothing enabled (baseline).
+func finishTests(ss *search.State, baseline *search.Outcome) {
+	list := func(tests []string) string {
+		if len(tests) == 0 {
+			return "(none)"
+		}
+		return strings.Join(tests, ", ")
+	}
+	fmt.Printf("Tests failing with the culprit: %s\n", list(ss.FailedTests))
+	fmt.Printf("Tests failing without it: %s\n", list(baseline.FailedTests))
+}
+
+func finish(ss *search.State, oracle *search.CommandOracle) {
+	printGSF := func() {
+		if f := gossafunc(ss.LastTrigger); f != "" {
+			fmt.Printf("GOSSAFUNC='%s' ", f)
+		}
+	}
+
+	printCL := func() {
+		fmt.Printf(" %s", oracle.CommandLine())
+	}
 
-		case PASSED0, DONE0:
-			// If we are here, the test is flaky.
-			fmt.Fprintf(os.Stdout, "Combination of empty and pass, discard path (test is flaky)\n")
-			if ss.next_singleton_hash_index == len(ss.hashes) {
-				return false
+	printPOS := func(lastTrigger, intro string) {
+		inlineLocs := inlineLocations(lastTrigger)
+		if len(inlineLocs) == 1 {
+			fmt.Printf("%s %s\n", intro, inlineLocs[0])
+		} else if len(inlineLocs) > 1 {
+			fmt.Printf("%s:\n", intro)
+			sfx := ""
+			for _, l := range inlineLocs {
+				fmt.Printf("\t%s%s\n", l, sfx)
+				sfx = " (inlined function)"
 			}
-			confirmed_suffix = ss.hashes[len(ss.hashes)-1]
-			ss.hashes = ss.hashes[0 : len(ss.hashes)-1]
-			continue
+		}
+	}
 
-		case DONE:
-			if ss.next_singleton_hash_index == len(ss.hashes) {
-				return true
+	if len(ss.Hashes) == 0 {
+		fmt.Printf("FINISHED, suggest this command line for debugging:\n")
+	} else {
+		fmt.Printf("FINISHED, after filtering, suggest this command line for debugging:\n")
+	}
+	printGSF()
+	fmt.Printf("%s", ss.Env(false))
+	printCL()
+	fmt.Println()
+	if ss.Crash != "" {
+		fmt.Printf("Crash signature: %s\n", ss.Crash)
+	}
+
+	intro := "Problem is at"
+	for _, ht := range hashTriggers(ss) {
+		printPOS(ht.Trigger, intro)
+		intro = "and"
+		if names := ss.Collisions[ht.Hash]; len(names) > 0 {
+			fmt.Printf("Hash collision, %s=%s triggers %d distinct names with the same hash:\n", ht.Var, ht.Hash, len(names))
+			for _, n := range names {
+				fmt.Printf("\t%s\n", n)
 			}
-			// Randomly choose another place to work.
-			j := rand.Intn(len(ss.hashes)-ss.next_singleton_hash_index) + ss.next_singleton_hash_index
-			confirmed_suffix = ss.hashes[j]
-			ss.hashes[j] = ss.hashes[ss.next_singleton_hash_index]
-			ss.hashes[ss.next_singleton_hash_index] = ss.suffix
-			ss.next_singleton_hash_index++
-			continue
 		}
 	}
-	return false
 }
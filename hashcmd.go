@@ -0,0 +1,259 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dr2chase/gossahash/hashdebug"
+)
+
+// A hashName is a name, with the parameter (if any) hashed with it.
+type hashName struct {
+	name  string
+	param uint64
+}
+
+func (n hashName) hash() uint64 {
+	return hashdebug.Hash(n.name, n.param)
+}
+
+// nameSources are the flags of the hash and lookup subcommands that
+// say where names come from, besides the command line.
+type nameSources struct {
+	file string // names, one per line
+	nm   string // binary whose text symbols are names
+	src  string // Go source file or directory whose functions are names
+	pkg  string // package path for names from src
+	fail bool   // the names of the -F test program
+}
+
+func (ns *nameSources) register(fs *flag.FlagSet) {
+	fs.StringVar(&ns.file, "file", "", "read names, one per line, from this file")
+	fs.StringVar(&ns.nm, "nm", "", "use the functions listed by go tool nm for this binary")
+	fs.StringVar(&ns.src, "src", "", "use the functions declared in this Go source file or directory")
+	fs.StringVar(&ns.pkg, "pkg", "", "with -src, the package path that qualifies the functions (default the package name)")
+	fs.BoolVar(&ns.fail, "F", false, "use the names (and parameters) of the -F test program")
+}
+
+// names returns the names in args and those from ns's sources.
+func (ns *nameSources) names(args []string) ([]hashName, error) {
+	var hns []hashName
+	add := func(names ...string) {
+		for _, n := range names {
+			hns = append(hns, hashName{name: n})
+		}
+	}
+	add(args...)
+	if ns.fail {
+		for i, n := range names {
+			hns = append(hns, hashName{name: n, param: uint64(i)})
+		}
+	}
+	if ns.file != "" {
+		data, err := ioutil.ReadFile(ns.file)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				add(line)
+			}
+		}
+	}
+	if ns.nm != "" {
+		out, err := exec.Command("go", "tool", "nm", ns.nm).Output()
+		if err != nil {
+			return nil, fmt.Errorf("go tool nm %s: %v", ns.nm, err)
+		}
+		add(nmFunctions(out)...)
+	}
+	if ns.src != "" {
+		names, err := sourceFunctions(ns.src, ns.pkg)
+		if err != nil {
+			return nil, err
+		}
+		add(names...)
+	}
+	return hns, nil
+}
+
+// nmFunctions returns the names of the text symbols in the output of
+// go tool nm.
+func nmFunctions(out []byte) []string {
+	var fns []string
+	scanner := bufio.NewScanner(bytes.NewBuffer(out))
+	for scanner.Scan() {
+		// 4a2b40 T main.main
+		f := strings.Fields(scanner.Text())
+		if len(f) >= 3 && (f[1] == "T" || f[1] == "t") {
+			fns = append(fns, strings.Join(f[2:], " "))
+		}
+	}
+	return fns
+}
+
+// sourceFunctions returns the names of the functions and methods
+// declared in the Go source file or directory path, qualified by pkg
+// (or by the package name, if pkg is empty) as the compiler names
+// them, e.g., pkg.F, pkg.T.M, and pkg.(*T).M.
+func sourceFunctions(path, pkg string) ([]string, error) {
+	fset := token.NewFileSet()
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		files, _ = filepath.Glob(filepath.Join(path, "*.go"))
+	}
+	var fns []string
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, declaredFunctions(f, pkg)...)
+	}
+	return fns, nil
+}
+
+// declaredFunctions returns the functions and methods declared in f,
+// as for sourceFunctions.
+func declaredFunctions(f *ast.File, pkg string) []string {
+	if pkg == "" {
+		pkg = f.Name.Name
+	}
+	var fns []string
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := fd.Name.Name
+		if fd.Recv != nil && len(fd.Recv.List) == 1 {
+			name = receiverName(fd.Recv.List[0].Type) + "." + name
+		}
+		fns = append(fns, pkg+"."+name)
+	}
+	return fns
+}
+
+// receiverName returns the name of a method's receiver type, as the
+// compiler writes it in method names: T or (*T), without type
+// parameters.
+func receiverName(t ast.Expr) string {
+	switch t := t.(type) {
+	case *ast.StarExpr:
+		return "(*" + receiverName(t.X) + ")"
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.ParenExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
+
+// hashCommand is the hash subcommand, which prints the hash of each
+// name.
+func hashCommand(args []string) {
+	fs := flag.NewFlagSet("hash", flag.ExitOnError)
+	var ns nameSources
+	ns.register(fs)
+	bits := fs.Int("hashlen", hashLimit, "print the low this many bits of each hash, as a suffix")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s hash [flags] [name ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *bits < 1 || *bits > 64 {
+		fmt.Printf("-hashlen must be between 1 and 64, not %d\n", *bits)
+		os.Exit(1)
+	}
+	hns, err := ns.names(fs.Args())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	mask := ^uint64(0) >> (64 - *bits)
+	for _, n := range hns {
+		h := n.hash()
+		fmt.Printf("%0*b 0x%016x %s", *bits, h&mask, h, n.name)
+		if n.param != 0 {
+			fmt.Printf(" %d", n.param)
+		}
+		fmt.Println()
+	}
+}
+
+// lookupCommand is the lookup subcommand, which prints the names
+// whose hashes a hash setting matches.
+func lookupCommand(args []string) {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	var ns nameSources
+	ns.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lookup [flags] SUFFIX [name ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	setting := fs.Arg(0)
+	// Accept a whole environment setting, e.g., GOCOMPILEDEBUG=gossahash=0110.
+	if i := strings.LastIndex(setting, "="); i != -1 {
+		setting = setting[i+1:]
+	}
+	hd, err := hashdebug.Parse(hash_ev_string, setting)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	hns, err := ns.names(fs.Args()[1:])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	matched := 0
+	for _, n := range hns {
+		v, ok := hd.MatchHash(n.hash())
+		if !ok {
+			continue
+		}
+		matched++
+		fmt.Printf("%s", n.name)
+		if v != hash_ev_string && v != "" {
+			// A hash of a multiple-point setting.
+			fmt.Printf(" (%s)", v)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d of %d names match %s\n", matched, len(hns), fs.Arg(0))
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestDeclaredFunctions(t *testing.T) {
+	src := `package p
+func F() {}
+func (T) M() {}
+func (t *T) N() {}
+func (l *List[E]) Push(e E) {}
+func (m *Map[K, V]) Put(k K, v V) {}
+var V = func() {}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"example.com/p.F", "example.com/p.T.M", "example.com/p.(*T).N", "example.com/p.(*List).Push", "example.com/p.(*Map).Put"}
+	if got := declaredFunctions(f, "example.com/p"); !reflect.DeepEqual(got, want) {
+		t.Errorf("declaredFunctions = %v, want %v", got, want)
+	}
+	want = []string{"p.F", "p.T.M", "p.(*T).N", "p.(*List).Push", "p.(*Map).Put"}
+	if got := declaredFunctions(f, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("declaredFunctions without a package path = %v, want %v", got, want)
+	}
+}
+
+func TestNmFunctions(t *testing.T) {
+	out := `  4a2b40 T main.main
+  4a2c00 t main.(*T).m
+  5c1000 D main.x
+  4a2d00 T type:.eq.main.T
+         U _cgo_panic
+`
+	want := []string{"main.main", "main.(*T).m", "type:.eq.main.T"}
+	if got := nmFunctions([]byte(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("nmFunctions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hashdebug gates a change (for example, a risky optimization)
+// with a hash of the name of each place it is applied, using the same
+// protocol as the Go compiler's HashDebug, so that gossahash can search
+// for the place(s) where the change causes a failure.
+//
+// A program typically creates one HashDebug from an environment variable:
+//
+//	var hd = hashdebug.New("myopthash", os.Getenv("MYOPTHASH"), nil)
+//
+//	if hd.Match(pkg + "." + fn) {
+//		// apply the risky optimization to fn
+//	}
+//
+// and is searched with
+//
+//	gossahash -E MYOPTHASH= -e myopthash ./mytest.bash
+//
+// The value of the variable is a list of binary hash suffixes separated
+// by '/', '+', ',' or spaces.  A name matches if the low-order bits of its
+// hash equal one of the suffixes and none of the suffixes preceded by '-'
+// (exclusions).  Patterns in the syntax of the bisect tool
+// (golang.org/x/tools/cmd/bisect), such as "v0101+110-0011", are also
+// accepted.  The first suffix is reported as the variable's name, and
+// the others as the name followed by 0, 1, 2, ....  A value of "y" matches
+// everything, and "n" matches nothing.  If the variable is empty (unset),
+// New returns nil, and a nil HashDebug matches everything without
+// reporting, so the check is cheap when no search is in progress.
+//
+// Each match is reported on a line of the form
+//
+//	myopthash triggered pkg.fn 0x123456789abcdef
+//	pkg.fn [bisect-match 0x123456789abcdef]
+//
+// written to the file named by GSHS_LOGFILE if it is set, else to the
+// writer given to New, else to standard output.
+package hashdebug
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type hashAndMask struct {
+	// a hash h matches if (h^hash)&mask == 0
+	hash uint64
+	mask uint64
+	name string // base name, or base name + "0", "1", etc.
+}
+
+// A HashDebug decides whether a name matches the hash suffixes
+// given in its variable.  It is safe for concurrent use.
+type HashDebug struct {
+	name     string        // base name of the flag/variable.
+	matches  []hashAndMask // A hash matches if one of these matches.
+	excludes []hashAndMask // explicitly excluded hash suffixes
+	yes, no  bool
+
+	// BisectOnly, if set, limits reports of matches to the
+	// [bisect-match ...] form.
+	BisectOnly bool
+
+	mu      sync.Mutex
+	logfile io.Writer // opened lazily, on first match
+	opened  bool      // GSHS_LOGFILE has been checked
+}
+
+func toHashAndMask(s, varname string) (hashAndMask, error) {
+	l := len(s)
+	if l > 64 {
+		s = s[l-64:]
+		l = 64
+	}
+	m := ^(^uint64(0) << l)
+	h, err := strconv.ParseUint(s, 2, 64)
+	if err != nil {
+		return hashAndMask{}, fmt.Errorf("could not parse %s (=%s) as a binary number", varname, s)
+	}
+
+	return hashAndMask{name: varname, hash: h, mask: m}, nil
+}
+
+// New returns a new hash-debug tester for the variable ev, whose
+// value is s.  If s is empty, it returns nil, allowing a lightweight
+// check for normal-case behavior.  Matches are reported to file,
+// unless GSHS_LOGFILE names a file; if file is nil, standard output
+// is used.  New panics if s cannot be parsed; see Parse.
+func New(ev, s string, file io.Writer) *HashDebug {
+	hd, err := Parse(ev, s)
+	if err != nil {
+		panic(err)
+	}
+	if hd != nil {
+		hd.logfile = file
+	}
+	return hd
+}
+
+// Parse is like New, but returns an error if s cannot be parsed,
+// and always reports to GSHS_LOGFILE or standard output.
+func Parse(ev, s string) (*HashDebug, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	hd := &HashDebug{name: ev}
+	// Ignore leading 'v' from bisect; y means everything
+	// (less any exclusions, in a bisect pattern) and n nothing.
+	p := strings.TrimLeft(s, "v")
+	if p != "" {
+		switch p[0] {
+		case 'y', 'Y':
+			if !strings.Contains(p, "-") {
+				hd.yes = true
+				return hd, nil
+			}
+		case 'n', 'N':
+			hd.no = true
+			return hd, nil
+		}
+	}
+	var ss []string
+	var sc string // current
+	for _, c := range s {
+		switch c {
+		// Ignore leading 'v' from bisect also.
+		case '/', '+', ',', ' ', '\t', '-', 'v':
+			if len(sc) > 0 {
+				ss = append(ss, sc)
+				sc = ""
+			}
+		default:
+			sc += string(c)
+			continue
+		}
+		if c == '-' {
+			sc = "-"
+		}
+	}
+	if len(sc) > 0 {
+		ss = append(ss, sc)
+		sc = ""
+	}
+
+	// hash searches may use additional EVs with 0, 1, 2, ... suffixes.
+	i := 0
+	for _, s := range ss {
+		if s == "y" || s == "Y" {
+			// Matches everything, less exclusions.
+			continue
+		}
+		if s == "" {
+			if i != 0 || len(ss) > 1 && ss[1] != "" || len(ss) > 2 {
+				return nil, fmt.Errorf("empty hash match string for %s should be first (and only) one", ev)
+			}
+			// Special case of should match everything.
+			for _, b := range []string{"0", "1"} {
+				m, _ := toHashAndMask(b, ev+b)
+				hd.matches = append(hd.matches, m)
+			}
+			break
+		}
+		var m hashAndMask
+		var err error
+		if s[0] == '-' {
+			m, err = toHashAndMask(s[1:], fmt.Sprintf("%s%d", "HASH_EXCLUDE", i))
+			hd.excludes = append(hd.excludes, m)
+		} else {
+			if i == 0 {
+				m, err = toHashAndMask(s, ev)
+			} else {
+				m, err = toHashAndMask(s, fmt.Sprintf("%s%d", ev, i-1))
+			}
+			hd.matches = append(hd.matches, m)
+			i++
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hd, nil
+}
+
+// Hash returns the hash of pkgAndName and param that is matched
+// against hash suffixes; it is the same hash as the one used by the
+// Go compiler's HashDebug, from which this package is derived.
+func Hash(pkgAndName string, param uint64) uint64 {
+	hbytes := sha1.Sum([]byte(pkgAndName))
+	hash := uint64(hbytes[7])<<56 + uint64(hbytes[6])<<48 +
+		uint64(hbytes[5])<<40 + uint64(hbytes[4])<<32 +
+		uint64(hbytes[3])<<24 + uint64(hbytes[2])<<16 +
+		uint64(hbytes[1])<<8 + uint64(hbytes[0])
+
+	if param != 0 {
+		// Because param is probably a line number, probably near zero,
+		// hash it up a little bit, but even so only the lower-order bits
+		// likely matter because search focuses on those.
+		p0 := param + uint64(hbytes[9]) + uint64(hbytes[10])<<8 +
+			uint64(hbytes[11])<<16 + uint64(hbytes[12])<<24
+
+		p1 := param + uint64(hbytes[13]) + uint64(hbytes[14])<<8 +
+			uint64(hbytes[15])<<16 + uint64(hbytes[16])<<24
+
+		param += p0 * p1
+		param ^= param>>17 ^ param<<47
+	}
+
+	return hash ^ param
+}
+
+// Match returns true if either the variable used to create d is
+// unset, or if its value is y, or if it is a suffix of the base-two
+// representation of the hash of pkgAndName.  If the variable is not nil,
+// then a true result is accompanied by stylized output to d.logfile, which
+// is used for automated bug search.
+func (d *HashDebug) Match(pkgAndName string) bool {
+	return d.MatchParam(pkgAndName, 0)
+}
+
+// MatchParam returns true if either the variable used to create d is
+// unset, or if its value is y, or if it is a suffix of the base-two
+// representation of the hash of pkgAndName and param. If the variable is not
+// nil, then a true result is accompanied by stylized output to d.logfile,
+// which is used for automated bug search.
+func (d *HashDebug) MatchParam(pkgAndName string, param uint64) bool {
+	if d == nil {
+		return true
+	}
+	hash := Hash(pkgAndName, param)
+	name, ok := d.MatchHash(hash)
+	if ok {
+		xstr := fmt.Sprintf("0x%x", hash)
+		d.logDebugHashMatch(name, pkgAndName, xstr, param)
+	}
+	return ok
+}
+
+// MatchHash reports whether hash matches d, without reporting the
+// match, and if so, the name of the variable (e.g., gossahash or
+// gossahash0) whose suffix it matched.  A nil HashDebug matches
+// every hash, with an empty name.
+func (d *HashDebug) MatchHash(hash uint64) (string, bool) {
+	if d == nil {
+		return "", true
+	}
+	if d.no {
+		return "", false
+	}
+	for _, m := range d.excludes {
+		if (m.hash^hash)&m.mask == 0 {
+			return "", false
+		}
+	}
+
+	if len(d.matches) == 0 || d.yes {
+		return d.name, true
+	}
+
+	for _, m := range d.matches {
+		if (m.hash^hash)&m.mask == 0 {
+			return m.name, true
+		}
+	}
+	return "", false
+}
+
+func (d *HashDebug) logDebugHashMatch(varname, name, hstr string, param uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	file := d.logfile
+	if tmpfile := os.Getenv("GSHS_LOGFILE"); tmpfile != "" && !d.opened {
+		f, err := os.OpenFile(tmpfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			panic(fmt.Errorf("could not open hash-testing logfile %s", tmpfile))
+		}
+		file = f
+		d.logfile = file
+	}
+	d.opened = true
+	if file == nil {
+		file = os.Stdout
+		d.logfile = file
+	}
+	if len(hstr) > 32 {
+		hstr = hstr[len(hstr)-32:]
+	}
+	// External tools depend on this string
+	if param == 0 {
+		// loopvarhash1 triggered ./a/a.go:11:6 001001011000010011100011
+		if !d.BisectOnly {
+			fmt.Fprintf(file, "%s triggered %s %s\n", varname, name, hstr)
+		}
+		// ./a/a.go:11:6 [bisect-match 0x800ddd09be2584e3]
+		fmt.Fprintf(file, "%s [bisect-match %s]\n", name, hstr)
+	} else {
+		if !d.BisectOnly {
+			fmt.Fprintf(file, "%s triggered %s:%d %s\n", varname, name, param, hstr)
+		}
+		fmt.Fprintf(file, "%s:%d [bisect-match %s]\n", name, param, hstr)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashdebug
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMatchHash(t *testing.T) {
+	const full = 0xfedcba9876543210
+	tests := []struct {
+		value string
+		hash  uint64
+		name  string // "" means no match
+	}{
+		{"y", 0b1011, "gossahash"},
+		{"Y", 0, "gossahash"},
+		{"n", 0b1011, ""},
+		{"vn", 0b1011, ""},
+
+		{"011", 0b1011, "gossahash"},
+		{"011", 0b1010, ""},
+		{"v011", 0b1011, "gossahash"},
+
+		// Later suffixes are reported as gossahash0, gossahash1, ...
+		{"01/10/11", 0b101, "gossahash"},
+		{"01/10/11", 0b110, "gossahash0"},
+		{"01/10/11", 0b111, "gossahash1"},
+		{"01/10/11", 0b100, ""},
+		{"v01+10+11", 0b111, "gossahash1"},
+		{"01,10 11", 0b110, "gossahash0"},
+
+		// Exclusions take precedence over matches.
+		{"1-01", 0b101, ""},
+		{"1-01", 0b111, "gossahash"},
+		{"v+1-01", 0b101, ""},
+		{"-01+1", 0b101, ""},
+		{"-01+1", 0b011, "gossahash"},
+
+		// y with exclusions matches everything else.
+		{"y-01", 0b101, ""},
+		{"y-01", 0b110, "gossahash"},
+		{"vy-01-10", 0b110, ""},
+		{"vy-01-10", 0b111, "gossahash"},
+
+		// Only exclusions match everything else, too.
+		{"-01", 0b110, "gossahash"},
+		{"-01", 0b001, ""},
+
+		// A 64-digit suffix matches only the whole hash, and longer
+		// suffixes are cut to their low 64 bits.
+		{fmt.Sprintf("%064b", uint64(full)), full, "gossahash"},
+		{fmt.Sprintf("%064b", uint64(full)), full ^ 1<<63, ""},
+		{"1" + fmt.Sprintf("%064b", uint64(full)), full, "gossahash"},
+	}
+	for _, test := range tests {
+		hd, err := Parse("gossahash", test.value)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.value, err)
+			continue
+		}
+		name, ok := hd.MatchHash(test.hash)
+		if ok != (test.name != "") || name != test.name {
+			t.Errorf("Parse(%q).MatchHash(%#b) = %q, %v, want %q", test.value, test.hash, name, ok, test.name)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, value := range []string{
+		"012",
+		"01/-",  // an empty exclusion
+		"01/x1", // not binary
+		"v01+-", // an empty exclusion, bisect style
+	} {
+		if hd, err := Parse("gossahash", value); err == nil {
+			t.Errorf("Parse(%q) = %+v, want error", value, hd)
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	hd, err := Parse("gossahash", "")
+	if hd != nil || err != nil {
+		t.Fatalf("Parse(\"\") = %v, %v, want nil, nil", hd, err)
+	}
+	if name, ok := hd.MatchHash(0b101); !ok || name != "" {
+		t.Errorf("nil MatchHash = %q, %v, want \"\", true", name, ok)
+	}
+	if !hd.Match("p.f") {
+		t.Errorf("nil Match = false, want true")
+	}
+}
+
+func TestMatchParam(t *testing.T) {
+	const name, param = "pkg.fn", 17
+	hash := Hash(name, param)
+	if hash == Hash(name, 0) {
+		t.Fatalf("Hash(%q, %d) == Hash(%q, 0)", name, param, name)
+	}
+	var b strings.Builder
+	suffix := fmt.Sprintf("%064b", hash)[64-8:]
+	hd := New("gossahash", suffix, &b)
+	if !hd.MatchParam(name, param) {
+		t.Fatalf("MatchParam(%q, %d) with suffix %s = false", name, param, suffix)
+	}
+	want := fmt.Sprintf("gossahash triggered pkg.fn:17 0x%x\npkg.fn:17 [bisect-match 0x%x]\n", hash, hash)
+	if b.String() != want {
+		t.Errorf("MatchParam reported\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	hd.BisectOnly = true
+	hd.MatchParam(name, param)
+	if want := fmt.Sprintf("pkg.fn:17 [bisect-match 0x%x]\n", hash); b.String() != want {
+		t.Errorf("BisectOnly MatchParam reported\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// TestLogFile checks that GSHS_LOGFILE is opened once, on the first
+// match, even when matches are reported concurrently.
+func TestLogFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "log")
+	t.Setenv("GSHS_LOGFILE", logFile)
+	var b strings.Builder
+	hd := New("gossahash", "y", &b)
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hd.MatchParam("pkg.fn", uint64(i+1))
+		}(i)
+	}
+	wg.Wait()
+
+	if b.Len() != 0 {
+		t.Errorf("matches were reported to the writer given to New, not GSHS_LOGFILE:\n%s", b.String())
+	}
+	data, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2*n {
+		t.Fatalf("GSHS_LOGFILE has %d lines, want %d:\n%s", len(lines), 2*n, data)
+	}
+	triggered := 0
+	for _, l := range lines {
+		if strings.HasPrefix(l, "gossahash triggered pkg.fn:") {
+			triggered++
+		} else if !strings.Contains(l, "[bisect-match 0x") {
+			t.Errorf("unexpected line %q", l)
+		}
+	}
+	if triggered != n {
+		t.Errorf("GSHS_LOGFILE has %d trigger lines, want %d", triggered, n)
+	}
+}
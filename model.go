@@ -0,0 +1,226 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A model describes when the -F test program fails.  It is written
+// as lines (or, in -model-spec, as clauses separated by ';'):
+//
+//	fail FORMULA   fail when FORMULA holds; several fail lines are OR'd
+//	flake P        a failing run passes anyway with probability P
+//	hang           hang (until killed) instead of failing
+//	crash          panic instead of failing, naming the fail line that held
+//	logfile        report triggers and failure only in GSHS_LOGFILE
+//	pos            report triggers as POS= positions, as -loopvar does
+//
+// A FORMULA is one or more terms joined by "and", where a term is
+// "K of SET", "all of SET", "any of SET", or a single name, and a SET
+// is a comma-separated list of names, "len=N" (the names of length
+// N), or "*" (all names).  Blank lines and lines beginning with '#'
+// are ignored.  The default model is "fail 4 of len=3".
+type model struct {
+	formulas [][]term // OR of ANDs
+	flake    float64
+	hang     bool
+	crash    bool
+	logfile  bool
+	pos      bool
+}
+
+// A term holds when at least k of its names are enabled.
+type term struct {
+	k     int
+	names map[string]bool
+}
+
+const defaultModel = "fail 4 of len=3"
+
+var (
+	modelFile = "" // Read the -F failure model from this file.
+	modelSpec = "" // The -F failure model, with ';' separating lines.
+)
+
+// readModel returns the model given by -model or -model-spec, or the
+// default model.
+func readModel() (*model, error) {
+	spec := modelSpec
+	if modelFile != "" {
+		data, err := ioutil.ReadFile(modelFile)
+		if err != nil {
+			return nil, err
+		}
+		spec = string(data)
+	}
+	if spec == "" {
+		spec = defaultModel
+	}
+	return parseModel(spec)
+}
+
+// parseModel parses the lines of a model.
+func parseModel(spec string) (*model, error) {
+	m := &model{}
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == '\n' || r == ';' }) {
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		switch f[0] {
+		case "fail":
+			t, err := parseFormula(f[1:])
+			if err != nil {
+				return nil, fmt.Errorf("model line %q: %v", line, err)
+			}
+			m.formulas = append(m.formulas, t)
+		case "flake":
+			if len(f) != 2 {
+				return nil, fmt.Errorf("model line %q: want flake P", line)
+			}
+			p, err := strconv.ParseFloat(f[1], 64)
+			if err != nil || p < 0 || p > 1 {
+				return nil, fmt.Errorf("model line %q: bad probability", line)
+			}
+			m.flake = p
+		case "hang":
+			m.hang = true
+		case "crash":
+			m.crash = true
+		case "logfile":
+			m.logfile = true
+		case "pos":
+			m.pos = true
+		default:
+			return nil, fmt.Errorf("model line %q: unknown keyword %s", line, f[0])
+		}
+	}
+	if len(m.formulas) == 0 {
+		return nil, fmt.Errorf("model has no fail lines")
+	}
+	return m, nil
+}
+
+// parseFormula parses the fields of a formula.
+func parseFormula(f []string) ([]term, error) {
+	var terms []term
+	for {
+		i := 0
+		for i < len(f) && f[i] != "and" {
+			i++
+		}
+		t, err := parseTerm(f[:i])
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+		if i == len(f) {
+			break
+		}
+		f = f[i+1:]
+	}
+	return terms, nil
+}
+
+// parseTerm parses the fields of a term.
+func parseTerm(f []string) (term, error) {
+	if len(f) == 1 {
+		if !isName(f[0]) {
+			return term{}, fmt.Errorf("unknown name %q", f[0])
+		}
+		return term{k: 1, names: map[string]bool{f[0]: true}}, nil
+	}
+	if len(f) != 3 || f[1] != "of" {
+		return term{}, fmt.Errorf("bad term %q", strings.Join(f, " "))
+	}
+	t := term{names: make(map[string]bool)}
+	for _, s := range strings.Split(f[2], ",") {
+		switch {
+		case s == "*":
+			for _, n := range names {
+				t.names[n] = true
+			}
+		case strings.HasPrefix(s, "len="):
+			l, err := strconv.Atoi(s[len("len="):])
+			if err != nil {
+				return term{}, fmt.Errorf("bad set %q", s)
+			}
+			for _, n := range names {
+				if len(n) == l {
+					t.names[n] = true
+				}
+			}
+		case isName(s):
+			t.names[s] = true
+		case s != "":
+			return term{}, fmt.Errorf("unknown name %q", s)
+		}
+	}
+	if len(t.names) == 0 {
+		return term{}, fmt.Errorf("empty set %q", f[2])
+	}
+	switch f[0] {
+	case "all":
+		t.k = len(t.names)
+	case "any":
+		t.k = 1
+	default:
+		k, err := strconv.Atoi(f[0])
+		if err != nil || k < 1 {
+			return term{}, fmt.Errorf("bad count %q", f[0])
+		}
+		if k > len(t.names) {
+			return term{}, fmt.Errorf("count %d exceeds the %d names of %q", k, len(t.names), f[2])
+		}
+		t.k = k
+	}
+	return t, nil
+}
+
+// isName reports whether s is one of the names of the -F test program.
+func isName(s string) bool {
+	for _, n := range names {
+		if n == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fails returns the number (counting from 1) of the first fail line
+// of m that holds when the names in enabled are enabled, or 0 if
+// none does.
+func (m *model) fails(enabled map[string]bool) int {
+	for i, ts := range m.formulas {
+		all := true
+		for _, t := range ts {
+			n := 0
+			for name := range t.names {
+				if enabled[name] {
+					n++
+				}
+			}
+			all = all && n >= t.k
+		}
+		if all {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+// enabled returns a set of the names given.
+func enabled(names ...string) map[string]bool {
+	m := make(map[string]bool)
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+func TestParseModel(t *testing.T) {
+	m, err := parseModel("# comment\nfail 2 of ant,bat,cat and gnu;fail all of dog,emu\n\nfail fox;flake 0.25;hang;crash;logfile;pos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.formulas) != 3 || m.flake != 0.25 || !m.hang || !m.crash || !m.logfile || !m.pos {
+		t.Fatalf("parseModel = %+v", m)
+	}
+	tests := []struct {
+		enabled map[string]bool
+		want    int
+	}{
+		{enabled("ant", "bat", "gnu"), 1},
+		{enabled("ant", "gnu"), 0},
+		{enabled("ant", "bat"), 0},
+		{enabled("dog", "emu", "ant"), 2},
+		{enabled("dog"), 0},
+		{enabled("fox", "dog", "emu"), 2},
+		{enabled("fox"), 3},
+		{enabled(), 0},
+	}
+	for _, test := range tests {
+		if got := m.fails(test.enabled); got != test.want {
+			t.Errorf("fails(%v) = %d, want %d", test.enabled, got, test.want)
+		}
+	}
+}
+
+func TestParseModelSets(t *testing.T) {
+	n3 := 0
+	for _, n := range names {
+		if len(n) == 3 {
+			n3++
+		}
+	}
+	for spec, want := range map[string]int{
+		defaultModel:           n3,
+		"fail any of len=3":    n3,
+		"fail 2 of *":          len(names),
+		"fail all of ant,,bat": 2,
+		"fail 1 of ant,ant":    1,
+	} {
+		m, err := parseModel(spec)
+		if err != nil {
+			t.Errorf("parseModel(%q): %v", spec, err)
+			continue
+		}
+		if got := len(m.formulas[0][0].names); got != want {
+			t.Errorf("parseModel(%q) has %d names, want %d", spec, got, want)
+		}
+	}
+}
+
+func TestParseModelErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"# only a comment",
+		"flake 0.5",
+		"fail",
+		"fail ant and",
+		"fail aardvark",
+		"fail 2 of ant,aardvark",
+		"fail 3 of ant,bat",
+		"fail 0 of ant,bat",
+		"fail x of ant",
+		"fail 2 from ant,bat",
+		"fail any of len=99",
+		"fail any of len=x",
+		"fail ant;flake 2",
+		"fail ant;flake",
+		"fail ant;explode",
+	} {
+		if m, err := parseModel(spec); err == nil {
+			t.Errorf("parseModel(%q) = %+v, want error", spec, m)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/dr2chase/gossahash/search"
+)
+
+// A Report is the machine-readable summary of a search, written by -json.
+type Report struct {
+	CommandLine    []string
+	Seed           int64
+	Trials         int     // Number of trials run (or replayed).
+	ElapsedSeconds float64 // Wall-clock time of the search.
+	Failures       []*FailureReport
+	Flakes         []search.Flake   `json:",omitempty"`
+	Unrelated      []*Unrelated     `json:",omitempty"` // Trials that failed for unrelated reasons.
+	Clusters       []*ClusterReport `json:",omitempty"` // Failures grouped by signature.
+}
+
+// A ClusterReport is a group of failures with the same signature.
+type ClusterReport struct {
+	Signature string
+	Failures  []int // Indexes in Report.Failures.
+}
+
+// Unrelated describes a trial that failed, but not in the way being searched for.
+type Unrelated struct {
+	Env string
+	Why string
+}
+
+// A FailureReport describes one failure found by the search.
+type FailureReport struct {
+	Stage    string `json:",omitempty"` // With -stages, the hash variable searched.
+	Suffix   string
+	Hashes   []string         `json:",omitempty"` // Additional hashes required for failure.
+	Triggers []*TriggerReport // One for the suffix, then one for each hash.
+
+	GOSSAFUNC string   `json:",omitempty"` // Suggested function for GOSSAFUNC.
+	Crash     string   `json:",omitempty"` // Signature of the crash, if the failure is one.
+	Signature string   `json:",omitempty"` // Signature of the failure (crash, failing tests, exit status).
+	Env       []string // Environment settings that reproduce the failure.
+	Command   []string // Command and arguments that reproduce the failure.
+	Repro     string   // The complete command line suggested for debugging.
+
+	// For -tests, the tests that fail with the failure's hashes
+	// enabled, and with nothing enabled.
+	FailedTests        []string `json:",omitempty"`
+	FailedTestsWithout []string `json:",omitempty"`
+}
+
+// A TriggerReport is the trigger line seen for one hash of a failure.
+type TriggerReport struct {
+	Var      string // The hash variable, e.g., gossahash or gossahash0.
+	Hash     string
+	Trigger  string
+	Position string   `json:",omitempty"` // For POS= triggers, the position of the problem,
+	Inlined  []string `json:",omitempty"` // and the positions of the functions it was inlined into.
+
+	Collision []string `json:",omitempty"` // Distinct triggers sharing this hash, which cannot be told apart.
+}
+
+func newReport(searcher *search.Searcher, sss []*search.State, oracle *search.CommandOracle, commandLine []string, start time.Time) *Report {
+	r := &Report{
+		CommandLine:    commandLine,
+		Seed:           seed,
+		Trials:         searcher.Trials(),
+		ElapsedSeconds: time.Since(start).Seconds(),
+		Failures:       []*FailureReport{},
+		Flakes:         searcher.Flakes(),
+	}
+	for _, u := range searcher.Unrelated() {
+		r.Unrelated = append(r.Unrelated, &Unrelated{Env: u.Env, Why: u.Outcome.Why})
+	}
+	for _, ss := range sss {
+		f := &FailureReport{
+			Suffix:    ss.Suffix,
+			Hashes:    ss.Hashes,
+			GOSSAFUNC: gossafunc(ss.LastTrigger),
+			Crash:     ss.Crash,
+			Signature: ss.Signature,
+			Env:       append(append([]string{}, oracle.Env...), ss.Env(false)),
+			Command:   append([]string{oracle.Command}, oracle.Args...),
+		}
+		if oracle.Tests != nil {
+			f.FailedTests = ss.FailedTests
+			f.FailedTestsWithout = searcher.Baseline().FailedTests
+		}
+		f.Repro = ss.Env(false) + " " + oracle.CommandLine()
+		if f.GOSSAFUNC != "" {
+			f.Repro = "GOSSAFUNC='" + f.GOSSAFUNC + "' " + f.Repro
+		}
+		for _, ht := range hashTriggers(ss) {
+			t := &TriggerReport{Var: ht.Var, Hash: ht.Hash, Trigger: ht.Trigger, Collision: ss.Collisions[ht.Hash]}
+			if locs := inlineLocations(ht.Trigger); len(locs) > 0 {
+				t.Position = locs[0]
+				t.Inlined = locs[1:]
+			}
+			f.Triggers = append(f.Triggers, t)
+		}
+		r.Failures = append(r.Failures, f)
+	}
+	index := make(map[*search.State]int)
+	for i, ss := range sss {
+		index[ss] = i
+	}
+	for _, c := range search.Clusters(sss) {
+		cr := &ClusterReport{Signature: c.Signature}
+		for _, ss := range c.States {
+			cr.Failures = append(cr.Failures, index[ss])
+		}
+		r.Clusters = append(r.Clusters, cr)
+	}
+	return r
+}
+
+// write writes r as indented JSON to file.
+func (r *Report) write(file string) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"strconv"
+	"strings"
+)
+
+// This file implements the pattern and marker formats of the
+// golang.org/x/tools/internal/bisect protocol, which is also used by
+// the Go compiler's hash debugging and the runtime's GODEBUG
+// bisection.
+//
+// A bisect pattern is an optional 'v' (verbose, i.e., print a
+// description along with each match marker), followed by either 'y'
+// (enable everything), 'n' (enable nothing), or a list of binary
+// suffixes, each preceded by '+' or '-' (the first '+' may be omitted).
+// The last suffix in the list that matches a hash decides whether it
+// is enabled, so exclusions follow all the '+' suffixes.
+//
+// Each enabled change is reported with a match marker of the form
+//
+//	description [bisect-match 0x0123456789abcdef]
+//
+// where the description may be empty, and the marker may also appear
+// in the middle of a line.  The hash may also be written in binary,
+// as up to 64 binary digits.
+
+const bisectMarker = "[bisect-match "
+
+// bisectPattern returns the bisect pattern that enables suffix and
+// hashes, except for excludes.
+func bisectPattern(suffix string, hashes, excludes []string) string {
+	p := "v"
+	if suffix == "" {
+		// The empty suffix matches everything.
+		p += "y"
+	} else {
+		p += suffix
+		for _, h := range hashes {
+			p += "+" + h
+		}
+	}
+	for _, x := range excludes {
+		p += "-" + x
+	}
+	return p
+}
+
+// cutMarker finds a bisect match marker in line, and returns the
+// line with the marker removed (the description of the match), the
+// hash in the marker, as written and as a number, and whether a
+// marker was found.
+func cutMarker(line string) (desc, h string, hv uint64, ok bool) {
+	i := strings.Index(line, bisectMarker)
+	if i < 0 {
+		return "", "", 0, false
+	}
+	j := strings.Index(line[i:], "]")
+	if j < 0 {
+		return "", "", 0, false
+	}
+	j += i
+	h = strings.TrimSpace(line[i+len(bisectMarker) : j])
+	var err error
+	if strings.HasPrefix(h, "0x") {
+		hv, err = strconv.ParseUint(h[2:], 16, 64)
+	} else {
+		// ParseUint also rejects more than 64 digits.
+		hv, err = strconv.ParseUint(h, 2, 64)
+	}
+	if err != nil {
+		return "", "", 0, false
+	}
+	desc = strings.TrimSpace(line[:i] + line[j+1:])
+	return desc, h, hv, true
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCutMarker(t *testing.T) {
+	bin64 := "1" + strings.Repeat("0", 62) + "1"
+	tests := []struct {
+		line string
+		desc string
+		h    string
+		hv   uint64
+		ok   bool
+	}{
+		{"./a/a.go:11:6 [bisect-match 0x800ddd09be2584e3]", "./a/a.go:11:6", "0x800ddd09be2584e3", 0x800ddd09be2584e3, true},
+		{"./a/a.go:11:6 [bisect-match 010101]", "./a/a.go:11:6", "010101", 0b010101, true},
+		{"p.f [bisect-match " + bin64 + "]", "p.f", bin64, 1<<63 | 1, true},
+		{"[bisect-match 0x12]", "", "0x12", 0x12, true},
+		{"[bisect-match 110]", "", "110", 0b110, true},
+		{"before [bisect-match 0x12] after", "before  after", "0x12", 0x12, true},
+		{"  [bisect-match 0x12] after", "after", "0x12", 0x12, true},
+
+		{"no marker", "", "", 0, false},
+		{"[bisect-match 0x12", "", "", 0, false},
+		{"[bisect-match 0xg]", "", "", 0, false},
+		{"[bisect-match 012]", "", "", 0, false},
+		{"[bisect-match ]", "", "", 0, false},
+		{"[bisect-match 1" + bin64 + "]", "", "", 0, false},
+	}
+	for _, test := range tests {
+		desc, h, hv, ok := cutMarker(test.line)
+		if desc != test.desc || h != test.h || hv != test.hv || ok != test.ok {
+			t.Errorf("cutMarker(%q) = %q, %q, %#x, %v, want %q, %q, %#x, %v", test.line,
+				desc, h, hv, ok, test.desc, test.h, test.hv, test.ok)
+		}
+	}
+}
+
+func TestMatchTriggerBinaryMarkers(t *testing.T) {
+	output := []byte("p.f [bisect-match 0101]\np.g [bisect-match 1101]\np.h [bisect-match 0110]\n")
+	m, last := MatchTrigger(output, "gossahash", "01", true)
+	if len(m) != 2 || last != "p.g" {
+		t.Errorf("MatchTrigger = %v, %q, want 2 triggers, last p.g", m, last)
+	}
+	if c := MatchCollisions([]byte("p.f [bisect-match 01]\np.g [bisect-match 01]\n"), "gossahash", "", true); c != nil {
+		t.Errorf("MatchCollisions of short binary markers = %v, want none", c)
+	}
+}
+
+func TestBisectPattern(t *testing.T) {
+	tests := []struct {
+		suffix   string
+		hashes   []string
+		excludes []string
+		want     string
+	}{
+		{"", nil, nil, "vy"},
+		{"", nil, []string{"01"}, "vy-01"},
+		{"101", nil, nil, "v101"},
+		{"101", []string{"0", "11"}, []string{"001"}, "v101+0+11-001"},
+	}
+	for _, test := range tests {
+		if got := bisectPattern(test.suffix, test.hashes, test.excludes); got != test.want {
+			t.Errorf("bisectPattern(%q, %q, %q) = %q, want %q", test.suffix, test.hashes, test.excludes, got, test.want)
+		}
+	}
+}
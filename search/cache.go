@@ -0,0 +1,145 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// A Cache remembers the outcomes of trials, keyed by the exact
+// environment setting of the trial and the test that was run, so that
+// a configuration need not be run twice.  A Cache may be shared by
+// several Searchers, and may be saved in a file for use by later
+// searches.  The file holds one cacheEntry per line, each appended as
+// its trial finishes; the last entry for a key wins.
+type Cache struct {
+	file string // if not empty, each new outcome is appended here
+
+	mu       sync.Mutex
+	outcomes map[string]*Outcome
+}
+
+// A cacheEntry is one line of a cache file.
+type cacheEntry struct {
+	Key     string
+	Outcome *Outcome
+}
+
+// NewCache returns an empty cache, or if file is not empty, a cache
+// loaded from file (if it exists) that saves new outcomes there.
+func NewCache(file string) (*Cache, error) {
+	c := &Cache{file: file, outcomes: make(map[string]*Outcome)}
+	if file == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var e cacheEntry
+		err := dec.Decode(&e)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// A partial last line is from a run that was interrupted.
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading cache %s: %v", file, err)
+		}
+		c.outcomes[e.Key] = e.Outcome
+	}
+	return c, nil
+}
+
+// Len returns the number of outcomes in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.outcomes)
+}
+
+// cacheKey returns the key for t in s's cache.  Outcomes also depend
+// on how triggers are read and on the options that turn runs into an
+// outcome, so those are part of the key, and a cache made with
+// different settings is not reused.
+func (s *Searcher) cacheKey(t *Trial) string {
+	key := t.Env + " " + s.opts.CacheKey
+	if s.opts.Bisect {
+		key += " bisect"
+	}
+	for _, r := range s.opts.Normalize {
+		key += fmt.Sprintf(" normalize=%q", r.Pattern.String()+"="+r.Replacement)
+	}
+	if s.opts.Repeat > 1 {
+		key += fmt.Sprintf(" repeat=%d fail-threshold=%g", s.opts.Repeat, s.opts.FailThreshold)
+	}
+	if s.opts.Focus != "" {
+		key += fmt.Sprintf(" focus=%q", s.opts.Focus)
+	}
+	return key
+}
+
+// cached returns the cached outcome for t, or nil if there is none.
+func (s *Searcher) cached(t *Trial) *Outcome {
+	c := s.opts.Cache
+	if c == nil || s.opts.Rerun {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.outcomes[s.cacheKey(t)]
+}
+
+// cache adds the outcome of t to s's cache, if any.
+func (s *Searcher) cache(t *Trial, o *Outcome) {
+	c := s.opts.Cache
+	if c == nil {
+		return
+	}
+	key := s.cacheKey(t)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.outcomes[key] == o {
+		return // it came from the cache
+	}
+	c.outcomes[key] = o
+	if c.file == "" {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Key: key, Outcome: o})
+	if err == nil {
+		var f *os.File
+		f, err = os.OpenFile(c.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err == nil {
+			_, err = f.Write(append(data, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving cache %s\n", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// cacheSearch searches a simulated two-point failure using the cache
+// in file.  It returns the failures found and the number of trials
+// the oracle ran.
+func cacheSearch(t *testing.T, file string) ([]string, int) {
+	t.Helper()
+	c, err := NewCache(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := &simulation{points: points(fNames(200)...), failures: [][]string{{"f3", "f150"}}}
+	ran := 0
+	oracle := OracleFunc(func(ctx context.Context, t *Trial) *Outcome {
+		ran++
+		return sim.Try(ctx, t)
+	})
+	s := New(oracle, Options{
+		EnvPrefix: "GOCOMPILEDEBUG=",
+		HashVar:   "gossahash",
+		Multiple:  1,
+		Seed:      3,
+		Cache:     c,
+		CacheKey:  "simulation",
+		Out:       ioutil.Discard,
+	})
+	return sim.found(s.Run("", "")), ran
+}
+
+func TestCacheFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+	want, ran := cacheSearch(t, file)
+	if len(want) != 1 || ran == 0 {
+		t.Fatalf("first search found %v in %d trials", want, ran)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	if len(lines) != ran {
+		t.Errorf("cache file has %d lines for %d trials", len(lines), ran)
+	}
+	if bytes.Contains(data, []byte(`"Output"`)) {
+		t.Errorf("cache file holds trial output")
+	}
+
+	// Everything is in the cache, and is not written again.
+	got, ran := cacheSearch(t, file)
+	if !reflect.DeepEqual(got, want) || ran != 0 {
+		t.Errorf("cached search found %v in %d trials, want %v in 0", got, ran, want)
+	}
+	if again, _ := ioutil.ReadFile(file); !bytes.Equal(again, data) {
+		t.Errorf("cached search rewrote the cache file")
+	}
+
+	// A partial last line, from an interrupted search, is ignored,
+	// and that trial is run again.
+	last := lines[len(lines)-1]
+	if err := ioutil.WriteFile(file, data[:len(data)-len(last)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCache(file)
+	if err != nil {
+		t.Fatalf("reading truncated cache: %v", err)
+	}
+	if c.Len() != len(lines)-1 {
+		t.Errorf("truncated cache has %d outcomes, want %d", c.Len(), len(lines)-1)
+	}
+	got, ran = cacheSearch(t, file)
+	if !reflect.DeepEqual(got, want) || ran != 1 {
+		t.Errorf("search with truncated cache found %v in %d trials, want %v in 1", got, ran, want)
+	}
+}
+
+func TestCacheFileCorrupt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+	if err := ioutil.WriteFile(file, []byte("{\"Key\":\"a\"}\nnot json\n{\"Key\":\"b\"}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCache(file); err == nil {
+		t.Errorf("NewCache of a corrupt file succeeded")
+	}
+	if _, err := NewCache(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("NewCache of a missing file: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// A Checkpoint records the progress of a search, so that an
+// interrupted search can be resumed.  Because the search is
+// deterministic given its random seed and the outcome of each trial,
+// a search that replays the recorded trials (see Options.Resume)
+// retraces its steps exactly, and continues from where it stopped.
+type Checkpoint struct {
+	CommandLine []string  // Command line of the search, for the user's benefit.
+	Seed        int64     // Random seed of the search.
+	Excludes    []string  // Suffixes excluded from the search.
+	States      []*State  // Failures found, followed by the search in progress.
+	Trials      []*Record // Every trial, in the order the search used them.
+}
+
+// A Record is the outcome of one trial of a search.
+type Record struct {
+	Env     string
+	Outcome *Outcome
+}
+
+// ReadCheckpoint reads a checkpoint written by a Searcher.
+func ReadCheckpoint(file string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %v", file, err)
+	}
+	return c, nil
+}
+
+// Trials returns the number of trials the search has used so far,
+// including any replayed from a checkpoint.
+func (s *Searcher) Trials() int {
+	return len(s.trials)
+}
+
+// replay returns the recorded outcome for t, if it is the next
+// recorded trial.  If it is not, the search has diverged from the
+// recording, and the rest of the recording is discarded.
+func (s *Searcher) replay(t *Trial) *Outcome {
+	if len(s.replaying) == 0 {
+		return nil
+	}
+	r := s.replaying[0]
+	if r.Env != t.Env {
+		s.printf("Resumed search diverged from checkpoint, expected %s, discarding %d recorded trials\n", r.Env, len(s.replaying))
+		s.replaying = nil
+		return nil
+	}
+	s.replaying = s.replaying[1:]
+	s.printf("Replaying: %s\n", r.Env)
+	if len(s.replaying) == 0 {
+		s.printf("Finished replaying checkpoint, resuming search\n")
+	}
+	return r.Outcome
+}
+
+// record notes the outcome of t and writes a new checkpoint, if
+// checkpoints are enabled.
+func (s *Searcher) record(t *Trial, o *Outcome) {
+	s.trials = append(s.trials, &Record{Env: t.Env, Outcome: o})
+	if s.opts.Checkpoint == "" {
+		return
+	}
+	c := &Checkpoint{
+		CommandLine: s.opts.CommandLine,
+		Seed:        s.opts.Seed,
+		Excludes:    s.excludes,
+		States:      s.states,
+		Trials:      s.trials,
+	}
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err == nil {
+		// Write and rename, so that an interrupt never leaves a partial checkpoint.
+		tmp := s.opts.Checkpoint + ".tmp"
+		err = ioutil.WriteFile(tmp, data, 0600)
+		if err == nil {
+			err = os.Rename(tmp, s.opts.Checkpoint)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing checkpoint %s\n", err)
+	}
+}
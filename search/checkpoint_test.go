@@ -0,0 +1,109 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkpointSearch searches a simulated two-point failure and an
+// independent one, with a checkpoint in file, resuming from resume if
+// it is not nil.  It returns the failures found, the searcher, and
+// the number of trials the oracle ran.
+func checkpointSearch(file string, resume *Checkpoint, out *bytes.Buffer) ([]string, *Searcher, int) {
+	sim := &simulation{points: points(fNames(200)...), failures: [][]string{{"f3", "f150"}, {"f60"}}}
+	ran := 0
+	oracle := OracleFunc(func(ctx context.Context, t *Trial) *Outcome {
+		ran++
+		return sim.Try(ctx, t)
+	})
+	s := New(oracle, Options{
+		EnvPrefix:  "GOCOMPILEDEBUG=",
+		HashVar:    "gossahash",
+		Multiple:   2,
+		Seed:       7,
+		Checkpoint: file,
+		Resume:     resume,
+		Out:        out,
+	})
+	sss := s.Run("", "")
+	return sim.found(sss), s, ran
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	want, s, ran := checkpointSearch(filepath.Join(dir, "full"), nil, &out)
+	if len(want) != 2 {
+		t.Fatalf("uninterrupted search found %v", want)
+	}
+	if ran != s.Trials() {
+		t.Fatalf("uninterrupted search ran %d trials, counted %d", ran, s.Trials())
+	}
+	c, err := ReadCheckpoint(filepath.Join(dir, "full"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Trials) != s.Trials() || c.Seed != 7 {
+		t.Fatalf("checkpoint has %d trials and seed %d, want %d and 7", len(c.Trials), c.Seed, s.Trials())
+	}
+
+	// Interrupt the search halfway, as the checkpoint would have been.
+	total := len(c.Trials)
+	c.Trials = c.Trials[:total/2]
+	out.Reset()
+	got, s, ran := checkpointSearch(filepath.Join(dir, "resumed"), c, &out)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed search found %v, want %v", got, want)
+	}
+	if ran != total-total/2 || s.Trials() != total {
+		t.Errorf("resumed search ran %d trials of %d, want %d of %d", ran, s.Trials(), total-total/2, total)
+	}
+	if strings.Contains(out.String(), "diverged") {
+		t.Errorf("resumed search diverged:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Finished replaying checkpoint") {
+		t.Errorf("resumed search did not finish replaying:\n%s", out.String())
+	}
+}
+
+func TestResumeDiverged(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	want, _, _ := checkpointSearch(filepath.Join(dir, "full"), nil, &out)
+	c, err := ReadCheckpoint(filepath.Join(dir, "full"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A recording from some other search diverges at its third trial.
+	c.Trials[2].Env += "0"
+	out.Reset()
+	got, s, ran := checkpointSearch(filepath.Join(dir, "resumed"), c, &out)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diverged search found %v, want %v", got, want)
+	}
+	if ran != s.Trials()-2 {
+		t.Errorf("diverged search ran %d of %d trials, want all but 2", ran, s.Trials())
+	}
+	if !strings.Contains(out.String(), "Resumed search diverged from checkpoint") {
+		t.Errorf("divergence not reported:\n%s", out.String())
+	}
+}
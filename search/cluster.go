@@ -0,0 +1,76 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Signature returns a description of the way o failed, to tell
+// different bugs apart: its crash signature, the tests that failed,
+// and its exit status, as far as they are known.
+func (o *Outcome) Signature() string {
+	var parts []string
+	if o.Crash != "" {
+		parts = append(parts, o.Crash)
+	}
+	if len(o.FailedTests) > 0 {
+		parts = append(parts, "failed "+strings.Join(o.FailedTests, ", "))
+	}
+	switch {
+	case o.ExitCode > 0:
+		parts = append(parts, fmt.Sprintf("exit status %d", o.ExitCode))
+	case o.ExitCode < 0:
+		parts = append(parts, "killed")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// focus turns a failure of o whose signature does not contain
+// Options.Focus into a pass.
+func (s *Searcher) focus(o *Outcome) {
+	if s.opts.Focus == "" || !o.Failed {
+		return
+	}
+	if sig := o.Signature(); !strings.Contains(sig, s.opts.Focus) {
+		o.Failed = false
+		o.Why = fmt.Sprintf("passed, as a different failure (%s)", sig)
+	}
+}
+
+// A Cluster is a group of failures with the same signature, which
+// are probably the same bug.
+type Cluster struct {
+	Signature string
+	States    []*State
+}
+
+// Clusters groups the failures found by a search by their signatures,
+// in the order in which each signature was first found.
+func Clusters(sss []*State) []*Cluster {
+	var cs []*Cluster
+	bySig := make(map[string]*Cluster)
+	for _, ss := range sss {
+		c := bySig[ss.Signature]
+		if c == nil {
+			c = &Cluster{Signature: ss.Signature}
+			bySig[ss.Signature] = c
+			cs = append(cs, c)
+		}
+		c.States = append(c.States, ss)
+	}
+	return cs
+}
@@ -0,0 +1,542 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CommandOracle runs an external test command for each trial,
+// with the trial's hash pattern added to its environment.
+type CommandOracle struct {
+	Command string
+	Args    []string
+	Env     []string // Additional environment settings, e.g., from the command line.
+
+	// Timeout in seconds to apply to command; failure if hit.
+	// Zero means run till done, negative means timing out is a pass.
+	Timeout int
+
+	// LogFile, if not empty, is passed to the command as GSHS_LOGFILE,
+	// and trigger information is read from there instead of from the
+	// command's output.
+	LogFile string
+
+	// TmpDir, if not empty, holds a separate directory for each
+	// worker, which is passed to the command as TMPDIR and which also
+	// holds that worker's copy of LogFile, so that trials running at
+	// the same time do not clobber each other.
+	TmpDir string
+
+	// A failure counts as the failure being searched for only if
+	// the command's exit code is one of FailExitCodes (if any are
+	// given) and its output matches FailRegexp (if not nil).  Other
+	// failures, and successes whose output does not match PassRegexp
+	// (if not nil), are unrelated to the search.  Output matching
+	// FailRegexp is a failure even if the command succeeds.
+	FailRegexp    *regexp.Regexp
+	PassRegexp    *regexp.Regexp
+	FailExitCodes []int
+
+	// Tests, if not nil, says that the command runs go test -json,
+	// and that a trial fails if and only if a test whose name
+	// matches Tests fails (or does not finish), whatever other tests
+	// do; FailRegexp, PassRegexp and FailExitCodes are not used.  If
+	// no matching test runs, the failure is unrelated, and if they
+	// are all skipped, the trial is skipped.
+	Tests *regexp.Regexp
+
+	// Stop, if not empty, ends a trial as soon as its output decides
+	// the outcome, rather than when the command exits (but see
+	// StopRule for when triggers are still to be counted).
+	Stop []StopRule
+
+	// SkipExitCode, if not zero, is the exit code with which the
+	// command says that it cannot tell whether the failure occurred
+	// (for example, because something else broke first), like
+	// git bisect's 125.
+	SkipExitCode int
+
+	Verbose bool      // Also print output of the command.
+	Out     io.Writer // Narrative output; nil means os.Stdout.
+}
+
+func (c *CommandOracle) String() string {
+	return c.Command
+}
+
+// CommandLine returns the additional environment, command, and
+// arguments, as they would be typed to a shell.
+func (c *CommandOracle) CommandLine() string {
+	line := ""
+	for _, e := range c.Env {
+		line += e + " "
+	}
+	line += c.Command
+	for _, a := range c.Args {
+		line += " " + a
+	}
+	return line
+}
+
+// CacheKey returns c's CommandLine, with the settings of c that
+// decide how an outcome is classified, to identify c's outcomes in a
+// Cache (see Options.CacheKey).
+func (c *CommandOracle) CacheKey() string {
+	key := c.CommandLine()
+	if c.Timeout != 0 {
+		key += fmt.Sprintf(" timeout=%d", c.Timeout)
+	}
+	if c.FailRegexp != nil {
+		key += fmt.Sprintf(" fail-regex=%q", c.FailRegexp)
+	}
+	if c.PassRegexp != nil {
+		key += fmt.Sprintf(" pass-regex=%q", c.PassRegexp)
+	}
+	if len(c.FailExitCodes) > 0 {
+		key += fmt.Sprintf(" fail-exit-codes=%v", c.FailExitCodes)
+	}
+	if c.SkipExitCode != 0 {
+		key += fmt.Sprintf(" skip-exit-code=%d", c.SkipExitCode)
+	}
+	if c.Tests != nil {
+		key += fmt.Sprintf(" tests=%q", c.Tests)
+	}
+	for _, r := range c.Stop {
+		key += fmt.Sprintf(" stop=%q", r.Pattern.String()+"="+r.Result)
+	}
+	return key
+}
+
+func (c *CommandOracle) out() io.Writer {
+	if c.Out == nil {
+		return os.Stdout
+	}
+	return c.Out
+}
+
+// workerDir returns the temporary directory for worker, creating it
+// if necessary, or "" if there is none.
+func (c *CommandOracle) workerDir(worker int) string {
+	if c.TmpDir == "" {
+		return ""
+	}
+	dir := filepath.Join(c.TmpDir, fmt.Sprintf("worker%d", worker))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating worker directory %s\n", err)
+	}
+	return dir
+}
+
+// Try runs the command for t and reports its outcome.
+func (c *CommandOracle) Try(ctx context.Context, t *Trial) *Outcome {
+	dir := c.workerDir(t.Worker)
+	logFile := c.LogFile
+	if logFile != "" && dir != "" {
+		logFile = filepath.Join(dir, filepath.Base(logFile))
+	}
+
+	// triggers counts t's distinct triggers reported so far, for
+	// StopRules that depend on them.
+	triggers := func(output []byte) int {
+		if logFile != "" {
+			if data, err := ioutil.ReadFile(logFile); err == nil {
+				output = data
+			}
+		}
+		if c.Tests != nil {
+			output = TestOutput(output)
+		}
+		m, _ := t.Match(output)
+		return len(m)
+	}
+
+	output, stopped, early, err := c.tryCmd(ctx, t.Env, logFile, dir, triggers)
+	var failed, unrelated, skipped bool
+	var failedTests []string
+	testsWhy := ""
+	if c.Tests != nil {
+		results := TestResults(output)
+		failedTests = testFailures(results)
+		if stopped == nil {
+			failed, unrelated, skipped, testsWhy = classifyTests(results, c.Tests)
+		}
+		output = TestOutput(output)
+	}
+	if stopped != nil {
+		failed = stopped.Result == "fail"
+	} else if c.Tests == nil {
+		failed, unrelated, skipped = c.classify(output, err)
+	}
+
+	crash := ""
+	if failed {
+		// Crashes are in the command's own output.
+		crash = CrashSignature(output)
+	}
+
+	if logFile != "" {
+		outputf, errorf := ioutil.ReadFile(logFile)
+		if errorf == nil {
+			output = outputf
+		}
+	}
+
+	o := &Outcome{Output: output, Failed: failed, Unrelated: unrelated, Skipped: skipped, Crash: crash, FailedTests: failedTests}
+	if ee, ok := err.(*exec.ExitError); ok {
+		o.ExitCode = ee.ExitCode()
+	} else if err != nil || early {
+		o.ExitCode = -1
+	}
+	o.Triggers, o.LastTrigger = t.Match(output)
+	o.Collisions = t.Collisions(output)
+	o.HashTriggers = t.HashTriggers(output)
+	if early {
+		o.Why = fmt.Sprintf("stopped early, output matched %q (%s)", stopped.Pattern, stopped.Result)
+	} else if stopped != nil {
+		o.Why = fmt.Sprintf("output matched %q (%s)", stopped.Pattern, stopped.Result)
+	} else if testsWhy != "" {
+		o.Why = testsWhy
+	} else if err != nil {
+		o.Why = err.Error()
+	} else if failed {
+		o.Why = "output matched failure pattern"
+	} else if unrelated {
+		o.Why = "output did not match pass pattern"
+	}
+	if skipped {
+		o.Why = "skipped: " + o.Why
+	}
+	return o
+}
+
+// classify decides whether the command failed, given its output and
+// the error from running it, whether that outcome is unrelated to
+// the failure being searched for, and whether the command skipped
+// the test.
+func (c *CommandOracle) classify(output []byte, err error) (failed, unrelated, skipped bool) {
+	// (err == nil) means success
+	if err == nil {
+		if c.FailRegexp != nil && c.FailRegexp.Match(output) {
+			return true, false, false
+		}
+		if c.PassRegexp != nil && !c.PassRegexp.Match(output) {
+			return false, true, false
+		}
+		return false, false, false
+	}
+	code := -1
+	if ee, ok := err.(*exec.ExitError); ok {
+		code = ee.ExitCode()
+	}
+	if c.SkipExitCode != 0 && code == c.SkipExitCode {
+		return false, false, true
+	}
+	if len(c.FailExitCodes) > 0 {
+		expected := false
+		for _, x := range c.FailExitCodes {
+			if x == code {
+				expected = true
+			}
+		}
+		if !expected {
+			return false, true, false
+		}
+	}
+	if c.FailRegexp != nil && !c.FailRegexp.Match(output) {
+		return false, true, false
+	}
+	return true, false, false
+}
+
+// tryCmd runs the test command with hashEnv (the suffix and all
+// the hashes) added to its environment, along with logFile as
+// GSHS_LOGFILE and dir as TMPDIR, if they are not empty.
+// If timeout is greater than zero then the command will be
+// killed after that many seconds (to help with bugs that exhibit
+// as an infinite loop), otherwise it runs to completion and the
+// error code and output are captured and returned.  The command
+// is also killed if ctx is canceled, or as soon as its output
+// satisfies one of c's StopRules (using triggers to count the
+// triggers reported so far).  The rule that decided the outcome, if
+// any, is returned, with early set if it stopped the command.
+func (c *CommandOracle) tryCmd(ctx context.Context, hashEnv, logFile, dir string, triggers func([]byte) int) (output []byte, stopped *StopRule, early bool, err error) {
+	cmd := exec.Command(c.Command)
+	cmd.Args = append(cmd.Args, c.Args...)
+
+	// Fill the env
+	cmd.Env = os.Environ()
+	extraEnv := make([]string, 0)
+
+	if logFile != "" {
+		// Create and truncate the file, then inject it into the environment
+		f, _ := os.Create(logFile)
+
+		f.Close()
+		ev := fmt.Sprintf("%s=%s", "GSHS_LOGFILE", logFile)
+		extraEnv = append(extraEnv, ev)
+	}
+	if dir != "" {
+		extraEnv = append(extraEnv, "TMPDIR="+dir)
+	}
+
+	extraEnv = append(extraEnv, hashEnv)
+
+	extraEnv = append(extraEnv, c.Env...)
+
+	cmd.Env = append(cmd.Env, extraEnv...)
+
+	line := ""
+	for _, e := range extraEnv {
+		line += e
+		line += " "
+	}
+	line += c.Command
+	for _, a := range c.Args {
+		line += " "
+		line += a
+	}
+	fmt.Fprintf(c.out(), "Trying: %s\n", line)
+
+	w := newWatcher(c.Stop, triggers)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	setProcessGroup(cmd)
+	// A child outside the process group (e.g., one that called
+	// setsid) can hold the output pipes open after the command has
+	// exited or been killed; do not wait for it forever.
+	cmd.WaitDelay = pipeWait
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- cmd.Wait()
+	}()
+
+	var timedOut bool
+	var timeoutMeansPass bool
+	var timer <-chan time.Time
+	t := c.Timeout
+	if t < 0 {
+		timeoutMeansPass = true
+		t = -t
+	}
+	if t > 0 {
+		tm := time.NewTimer(time.Second * time.Duration(t))
+		defer tm.Stop()
+		timer = tm.C
+	}
+
+	select {
+	case err = <-waitDone:
+	case <-timer:
+		timedOut = true
+		err = c.stop(cmd, waitDone)
+	case <-ctx.Done():
+		err = c.stop(cmd, waitDone)
+		fmt.Fprintf(c.out(), "Canceled: %s\n", hashEnv)
+	case r := <-w.stopped:
+		stopped, early = &r, true
+		err = c.stop(cmd, waitDone)
+		fmt.Fprintf(c.out(), "Stopped early (%s), output matched %q: %s\n", r.Result, r.Pattern, hashEnv)
+	}
+	c.reap(cmd)
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The command itself succeeded.
+		fmt.Fprintf(c.out(), "Output still open %v after the command exited, stopped reading it: %s\n", pipeWait, hashEnv)
+		err = nil
+	}
+	output = w.Bytes()
+	if !early {
+		stopped = w.Matched()
+	}
+	if timedOut {
+		status := "fail"
+		if timeoutMeansPass {
+			err = nil
+			status = "pass"
+		}
+		fmt.Fprintf(c.out(), "Timeout after %d seconds (%s): ", t, status)
+	}
+
+	if c.Verbose {
+		fmt.Fprintf(c.out(), "%s", string(output))
+	}
+	return
+}
+
+// stop interrupts cmd and all its children (its process group),
+// and kills them if cmd.Wait has not returned after 25 seconds,
+// reporting which processes had to be killed.  Children that hold the
+// output pipes open delay cmd.Wait by at most pipeWait (see tryCmd);
+// tryCmd then kills any left in the group (see reap).  waitDone
+// receives the result of cmd.Wait, which stop returns.
+func (c *CommandOracle) stop(cmd *exec.Cmd, waitDone chan error) error {
+	signalGroup(cmd, os.Interrupt)
+	select {
+	case err := <-waitDone:
+		return err
+	case <-time.After(25 * time.Second):
+	}
+	victims := groupMembers(cmd)
+	signalGroup(cmd, os.Kill)
+	if len(victims) > 0 {
+		fmt.Fprintf(c.out(), "Killed processes %s\n", strings.Join(victims, ", "))
+	} else {
+		fmt.Fprintf(c.out(), "Killed process group %d\n", cmd.Process.Pid)
+	}
+	return <-waitDone
+}
+
+// reap kills the processes left in cmd's process group after cmd has
+// exited, such as children that ignored stop's interrupt or were left
+// running in the background, and reports them.
+func (c *CommandOracle) reap(cmd *exec.Cmd) {
+	victims := groupMembers(cmd)
+	if len(victims) == 0 {
+		return
+	}
+	signalGroup(cmd, os.Kill)
+	fmt.Fprintf(c.out(), "Killed leftover processes %s\n", strings.Join(victims, ", "))
+}
+
+// pipeWait is how long to keep reading a command's output after the
+// command exits, if something else still holds it open.
+const pipeWait = 10 * time.Second
+
+var hashmatch = regexp.MustCompilePOSIX("[01]+|0x[0-9a-f]+")
+
+// MatchTrigger extracts hash trigger reports from the output.
+// repeats are collapsed, but counted in the returned map.  The
+// last match is also returned.  If bisect is set, trigger lines
+// are expected to contain bisect match markers, and only those
+// whose hash matches suffix are counted.  Trigger lines are
+// normalized by rewrites, if any, before they are counted.
+func MatchTrigger(output []byte, hash_ev_name, suffix string, bisect bool, rewrites ...Rewrite) (map[string]int, string) {
+	m := make(map[string]int)
+	var lastTrigger string
+	scanTriggers(output, hash_ev_name, suffix, bisect, rewrites, func(key, name string, full bool) {
+		m[key] = m[key] + 1
+		lastTrigger = name
+	})
+	return m, lastTrigger
+}
+
+// MatchCollisions returns the hashes in output (as for MatchTrigger)
+// that were reported for more than one distinct name, with those
+// names.  Such a hash cannot be split by a longer suffix.  Only
+// reports of full hashes count; names sharing a truncated hash may
+// still differ in the rest of it.
+func MatchCollisions(output []byte, hash_ev_name, suffix string, bisect bool, rewrites ...Rewrite) map[string][]string {
+	names := make(map[string][]string)
+	scanTriggers(output, hash_ev_name, suffix, bisect, rewrites, func(key, name string, full bool) {
+		if !full {
+			return
+		}
+		for _, n := range names[key] {
+			if n == name {
+				return
+			}
+		}
+		names[key] = append(names[key], name)
+	})
+	for key, n := range names {
+		if len(n) < 2 {
+			delete(names, key)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// fullHash reports whether h, a hash from a trigger line or marker,
+// is a whole hash (0x and hex digits, or 64 binary digits) rather
+// than the low bits of one.
+func fullHash(h string) bool {
+	return strings.HasPrefix(h, "0x") || len(h) == 64
+}
+
+// scanTriggers calls f with the key and name of each trigger report
+// for hash_ev_name in output that matches suffix, after normalizing it
+// with rewrites.  The key is the reported hash if it is a full hash
+// (see fullHash), in which case full is set; a truncated hash is keyed
+// with its name, and a report with no hash by the whole line.
+func scanTriggers(output []byte, hash_ev_name, suffix string, bisect bool, rewrites []Rewrite, f func(key, name string, full bool)) {
+	mask := uint64(1)<<len(suffix) - 1
+	suffixVal, _ := strconv.ParseUint(suffix, 2, 64)
+	suffixVal &= mask
+
+	triggerPrefix := hash_ev_name + " triggered"
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	for scanner.Scan() {
+		s := strings.TrimSpace(scanner.Text())
+		if bisect {
+			// ./a/a.go:11:6 [bisect-match 0x800ddd09be2584e3]
+			desc, h, hv, ok := cutMarker(s)
+			if !ok || hv&mask != suffixVal {
+				// Suffix must match
+				continue
+			}
+			name := normalize(desc, rewrites)
+			if fullHash(h) {
+				f(h, name, true)
+			} else {
+				f(h+" "+name, name, false)
+			}
+			continue
+		}
+		if strings.Contains(s, triggerPrefix) {
+			s = normalize(s, rewrites)
+		}
+		if pi := strings.Index(s, triggerPrefix); pi != -1 {
+			start := pi + len(triggerPrefix)
+			space := strings.LastIndex(s, " ")
+			key, full := s, false
+			if space < start {
+				space = len(s)
+			}
+			name := strings.TrimSpace(s[start:space])
+			if space < len(s) {
+				h := strings.TrimSpace(s[space:])
+				if ss := hashmatch.FindStringSubmatch(h); len(ss) == 1 && ss[0] == h {
+					if fullHash(h) {
+						key, full = h, true
+					} else {
+						key = h + " " + name
+					}
+				}
+			}
+			f(key, name, full)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// alive reports whether process pid is still running (not a zombie).
+func alive(pid int) bool {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	s := string(stat)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// TestLeftoverProcesses checks that children left in a trial's
+// process group, here one that ignores interrupts, are killed when
+// the trial ends, whether it times out or exits.
+func TestLeftoverProcesses(t *testing.T) {
+	if !alive(1) {
+		t.Skip("no /proc")
+	}
+	// The child prints its pid, and does not hold the output open.
+	const child = `(trap '' INT; exec sleep 100) >/dev/null 2>&1 & echo $!; `
+	tests := []struct {
+		name    string
+		script  string
+		timeout int
+	}{
+		{"timed out", child + "exec sleep 100", 1},
+		{"exited", child + "exit 0", 0},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		c := &CommandOracle{Command: "sh", Args: []string{"-c", test.script}, Timeout: test.timeout, Out: &out}
+		start := time.Now()
+		o := c.Try(context.Background(), &Trial{Env: "GOSSAHASH=y", Name: "gossahash"})
+		if d := time.Since(start); d > 20*time.Second {
+			t.Errorf("%s: trial took %v", test.name, d)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(o.Output)))
+		if err != nil {
+			t.Fatalf("%s: output %q is not a pid", test.name, o.Output)
+		}
+		for i := 0; i < 50 && alive(pid); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if alive(pid) {
+			t.Errorf("%s: child %d is still running:\n%s", test.name, pid, out.String())
+		}
+		if !strings.Contains(out.String(), "Killed leftover processes "+strconv.Itoa(pid)) {
+			t.Errorf("%s: leftover child not reported:\n%s", test.name, out.String())
+		}
+	}
+}
+
+// exitError returns the error from a command that exits with code,
+// nil for 0.
+func exitError(t *testing.T, code int) error {
+	err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+	if _, ok := err.(*exec.ExitError); code != 0 && !ok {
+		t.Fatalf("exit %d: %v", code, err)
+	}
+	return err
+}
+
+func TestClassify(t *testing.T) {
+	fail := regexp.MustCompile("BUG")
+	pass := regexp.MustCompile("PASS")
+	tests := []struct {
+		name       string
+		failRegexp *regexp.Regexp
+		passRegexp *regexp.Regexp
+		failCodes  []int
+		skipCode   int
+		output     string
+		code       int // -1 for an error that is not an exit status
+		want       string
+	}{
+		{name: "success", output: "ok", want: "pass"},
+		{name: "failure", output: "oops", code: 1, want: "fail"},
+		{name: "killed", output: "oops", code: -1, want: "fail"},
+
+		{name: "failure matching fail regexp", failRegexp: fail, output: "BUG", code: 1, want: "fail"},
+		{name: "failure not matching fail regexp", failRegexp: fail, output: "oops", code: 1, want: "unrelated"},
+		{name: "success matching fail regexp", failRegexp: fail, output: "BUG", want: "fail"},
+		{name: "success not matching fail regexp", failRegexp: fail, output: "ok", want: "pass"},
+
+		{name: "success matching pass regexp", passRegexp: pass, output: "PASS", want: "pass"},
+		{name: "success not matching pass regexp", passRegexp: pass, output: "ok", want: "unrelated"},
+		{name: "failure not matching pass regexp", passRegexp: pass, output: "oops", code: 1, want: "fail"},
+		{name: "success matching both", failRegexp: fail, passRegexp: pass, output: "PASS BUG", want: "fail"},
+
+		{name: "fail exit code", failCodes: []int{2, 3}, output: "oops", code: 3, want: "fail"},
+		{name: "other exit code", failCodes: []int{2, 3}, output: "oops", code: 1, want: "unrelated"},
+		{name: "killed with fail exit codes", failCodes: []int{2, 3}, output: "oops", code: -1, want: "unrelated"},
+		{name: "fail exit code not matching fail regexp", failCodes: []int{2}, failRegexp: fail, output: "oops", code: 2, want: "unrelated"},
+		{name: "fail exit code matching fail regexp", failCodes: []int{2}, failRegexp: fail, output: "BUG", code: 2, want: "fail"},
+		{name: "other exit code matching fail regexp", failCodes: []int{2}, failRegexp: fail, output: "BUG", code: 1, want: "unrelated"},
+
+		{name: "skip exit code", skipCode: 125, output: "cannot build", code: 125, want: "skip"},
+		{name: "skip exit code, matching fail regexp", skipCode: 125, failRegexp: fail, output: "BUG", code: 125, want: "skip"},
+		{name: "skip exit code among fail exit codes", skipCode: 125, failCodes: []int{125}, code: 125, want: "skip"},
+		{name: "skip exit code disabled", output: "oops", code: 125, want: "fail"},
+	}
+	for _, test := range tests {
+		c := &CommandOracle{FailRegexp: test.failRegexp, PassRegexp: test.passRegexp, FailExitCodes: test.failCodes, SkipExitCode: test.skipCode}
+		var err error
+		if test.code < 0 {
+			err = errors.New("signal: killed")
+		} else {
+			err = exitError(t, test.code)
+		}
+		failed, unrelated, skipped := c.classify([]byte(test.output), err)
+		got := "pass"
+		switch {
+		case failed && !unrelated && !skipped:
+			got = "fail"
+		case unrelated && !failed && !skipped:
+			got = "unrelated"
+		case skipped && !failed && !unrelated:
+			got = "skip"
+		case failed || unrelated || skipped:
+			got = fmt.Sprintf("failed=%v unrelated=%v skipped=%v", failed, unrelated, skipped)
+		}
+		if got != test.want {
+			t.Errorf("%s: classify = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+// TestStopRules checks that a stop rule that would cut off triggers
+// that decide the outcome of a search lets the command run to the end,
+// but still decides whether it failed.
+func TestStopRules(t *testing.T) {
+	const trigger = "echo gossahash triggered a.f 0x1; echo gossahash triggered b.g 0x2; "
+	const one = "echo gossahash triggered a.f 0x1; "
+	tests := []struct {
+		name     string
+		script   string
+		failed   bool
+		early    bool
+		triggers int
+	}{
+		{"fail", trigger + "echo FAIL; exec sleep 100", true, true, 2},
+		{"fail, trigger after", one + "echo FAIL; sleep 0.1; echo gossahash triggered b.g 0x2; exec sleep 100", true, true, 2},
+		{"fail, one trigger", one + "echo FAIL; sleep 0.1; exit 0", true, false, 1},
+		{"pass", one + "echo ok; exec sleep 100", false, true, 1},
+		{"pass, trigger after", "echo ok; sleep 0.1; " + one + "exec sleep 100", false, true, 1},
+		{"pass, no triggers", "echo ok; sleep 0.1; exit 3", false, false, 0},
+		{"untriggered", "echo link; exec sleep 100", false, true, 0},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		c := &CommandOracle{
+			Command: "sh",
+			Args:    []string{"-c", test.script},
+			Stop:    stopRules(t, "^FAIL=fail", "^ok=pass", "^link=untriggered"),
+			Out:     &out,
+		}
+		start := time.Now()
+		o := c.Try(context.Background(), &Trial{Env: "GOSSAHASH=y", Name: "gossahash"})
+		if d := time.Since(start); d > 20*time.Second {
+			t.Errorf("%s: trial took %v", test.name, d)
+		}
+		early := strings.HasPrefix(o.Why, "stopped early")
+		if o.Failed != test.failed || early != test.early || len(o.Triggers) != test.triggers || o.Unrelated || o.Skipped {
+			t.Errorf("%s: failed %v, stopped early %v, %d triggers (%s), want %v, %v, %d\n%s",
+				test.name, o.Failed, early, len(o.Triggers), o.Why, test.failed, test.early, test.triggers, out.String())
+		}
+		if !early && o.ExitCode == -1 {
+			t.Errorf("%s: exit code -1 from a command that ran to the end", test.name)
+		}
+	}
+}
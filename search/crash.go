@@ -0,0 +1,108 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// crashFrames is the number of user frames in a crash signature.
+const crashFrames = 3
+
+var (
+	crashHex     = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	crashSSA     = regexp.MustCompile(`\b([vb])[0-9]+\b`)
+	crashSignal  = regexp.MustCompile(`^\[signal (SIG[A-Z]+)`)
+	crashICE     = regexp.MustCompile(`internal compiler error: (.*)`)
+	crashRuntime = []string{"runtime.", "panic(", "testing."}
+)
+
+// CrashSignature returns a normalized signature of the first Go
+// panic, fatal error, or compiler internal error in output, or "" if
+// there is none.  A panic or fatal error is identified by its message
+// (and signal, if any) and the functions of its top few frames,
+// excluding the runtime, and an internal compiler error by its
+// message.  Addresses, and the SSA value and block numbers of internal
+// compiler errors, which vary from run to run, are replaced by 0x?
+// and v? or b?.
+func CrashSignature(output []byte) string {
+	var sig []string
+	frames := 0
+	inTrace := false
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if sig == nil {
+			if m := crashICE.FindStringSubmatch(line); m != nil {
+				return "internal compiler error: " + crashSSA.ReplaceAllString(normalizeCrash(m[1]), "${1}?")
+			}
+			for _, p := range []string{"panic: ", "fatal error: "} {
+				if strings.HasPrefix(line, p) {
+					sig = append(sig, normalizeCrash(line))
+				}
+			}
+			continue
+		}
+		switch {
+		case crashSignal.MatchString(line):
+			sig = append(sig, "[signal "+crashSignal.FindStringSubmatch(line)[1]+"]")
+		case strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, ":"):
+			inTrace = true
+		case !inTrace || line == "" || line[0] == '\t':
+			if inTrace && line == "" && frames > 0 {
+				return strings.Join(sig, " | ")
+			}
+		case strings.HasPrefix(line, "created by "):
+			return strings.Join(sig, " | ")
+		default:
+			fn := line
+			if strings.HasSuffix(fn, ")") {
+				if i := strings.LastIndex(fn, "("); i > 0 {
+					fn = fn[:i]
+				}
+			}
+			if isRuntimeFrame(fn) {
+				continue
+			}
+			if strings.Contains(fn, " ") || !strings.Contains(fn, ".") {
+				// Not a frame; the traceback is over.
+				return strings.Join(sig, " | ")
+			}
+			sig = append(sig, fn)
+			frames++
+			if frames == crashFrames {
+				return strings.Join(sig, " | ")
+			}
+		}
+	}
+	return strings.Join(sig, " | ")
+}
+
+func isRuntimeFrame(fn string) bool {
+	for _, p := range crashRuntime {
+		if strings.HasPrefix(fn, p) {
+			return true
+		}
+	}
+	return fn == "panic"
+}
+
+func normalizeCrash(s string) string {
+	return crashHex.ReplaceAllString(s, "0x?")
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import "testing"
+
+var crashSignatureTests = []struct {
+	name   string
+	output string
+	want   string
+}{
+	{"no crash", "ok\n", ""},
+	{
+		"nil pointer",
+		`panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x45a3b2]
+
+goroutine 1 [running]:
+main.g(...)
+	/tmp/x.go:7
+main.f({0xc000012345, 0x2, 0x2}, 0x7)
+	/tmp/x.go:10 +0x12
+main.main()
+	/tmp/x.go:14 +0x3a
+exit status 2
+`,
+		"panic: runtime error: invalid memory address or nil pointer dereference | [signal SIGSEGV] | main.g | main.f | main.main",
+	},
+	{
+		"recovered in a test, runtime frames first",
+		`panic: bad thing at 0xc000012345 [recovered]
+
+goroutine 7 [running]:
+testing.tRunner.func1.2({0x5d2e40, 0xc0000a2010})
+	/go/src/testing/testing.go:1632 +0x230
+panic({0x5d2e40?, 0xc0000a2010?})
+	/go/src/runtime/panic.go:785 +0x132
+p.(*T).m(0xc0000b8000)
+	/p/p.go:12 +0x1d
+created by testing.(*T).Run in goroutine 1
+`,
+		"panic: bad thing at 0x? [recovered] | p.(*T).m",
+	},
+	{
+		"internal compiler error",
+		"x.go:3:4: internal compiler error: bad value v123 in b7\n",
+		"internal compiler error: bad value v? in b?",
+	},
+}
+
+func TestCrashSignature(t *testing.T) {
+	for _, test := range crashSignatureTests {
+		if got := CrashSignature([]byte(test.output)); got != test.want {
+			t.Errorf("%s: CrashSignature = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"strings"
+)
+
+// ddmin returns a 1-minimal subset of set for which fails returns
+// true, that is, a failing subset from which no single element can be
+// removed without the failure going away.  fails(set) is assumed to
+// be true, and is never called on an empty set.  The order of the
+// elements is preserved.  This is Zeller and Hildebrandt's delta
+// debugging algorithm, "Simplifying and Isolating Failure-Inducing
+// Input", IEEE TSE 28(2), 2002.
+func ddmin(set []string, fails func([]string) bool) []string {
+	n := 2
+	for len(set) >= 2 {
+		chunks := split(set, n)
+		reduced := false
+		// A single chunk that fails is the quickest reduction.
+		for _, c := range chunks {
+			if fails(c) {
+				set, n, reduced = c, 2, true
+				break
+			}
+		}
+		if !reduced && n > 2 {
+			// Otherwise, remove one chunk (for n == 2, the
+			// complements are the chunks already tried).
+			for i := range chunks {
+				c := complement(chunks, i)
+				if fails(c) {
+					set, reduced = c, true
+					n--
+					break
+				}
+			}
+		}
+		if reduced {
+			continue
+		}
+		if n >= len(set) {
+			// Every single element has been removed in turn.
+			break
+		}
+		n *= 2
+		if n > len(set) {
+			n = len(set)
+		}
+	}
+	return set
+}
+
+// minimize returns a 1-minimal subset of set for which fails returns
+// true, as ddmin does, but first tries removing each element in turn.
+// Usually every element is needed, and that takes only one trial per
+// element; ddmin is used only if some element is not needed.
+func minimize(set []string, fails func([]string) bool) []string {
+	if len(set) < 2 {
+		return set
+	}
+	for i := range set {
+		c := append(append([]string(nil), set[:i]...), set[i+1:]...)
+		if fails(c) {
+			return ddmin(c, fails)
+		}
+	}
+	return set
+}
+
+// split divides set into n nearly-equal chunks, in order.
+func split(set []string, n int) [][]string {
+	chunks := make([][]string, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		end := start + (len(set)-start)/(n-i)
+		chunks = append(chunks, set[start:end])
+		start = end
+	}
+	return chunks
+}
+
+// complement returns the elements of all the chunks except chunks[i].
+func complement(chunks [][]string, i int) []string {
+	var c []string
+	for j, chunk := range chunks {
+		if j != i {
+			c = append(c, chunk...)
+		}
+	}
+	return c
+}
+
+// filter removes unnecessary hashes from a multi-point failure.
+// Because the tests can be flaky, hashes that aren't really necessary
+// may have been included; minimize reduces the suffix and hashes to a
+// set that fails, but not if any one of them is removed.
+func (ss *State) filter() {
+	s := ss.s
+	if len(ss.Hashes) == 0 {
+		s.printf("Not filtering, single point failure\n")
+		return
+	}
+	s.printf("Before filtering, multiple hashes required for failure:\n%s=%s", s.name, ss.Suffix)
+	for i, h := range ss.Hashes {
+		s.printf(" %s%d=%s", s.name, i, h)
+	}
+	s.printf("\n")
+
+	set := append([]string{ss.Suffix}, ss.Hashes...)
+	tried := make(map[string]bool)
+	trials := 0
+	fails := func(subset []string) bool {
+		key := strings.Join(subset, sep)
+		if r, ok := tried[key]; ok {
+			return r
+		}
+		trials++
+		ss.Hashes = subset[1:]
+		result := ss.trySuffix(subset[0])
+		r := result == FAILED || result == DONE || result == DONE0
+		tried[key] = r
+		return r
+	}
+	before := len(set)
+	set = minimize(set, fails)
+	ss.Suffix, ss.Hashes = set[0], append([]string(nil), set[1:]...)
+	if ss.NextSingleton > len(ss.Hashes) {
+		ss.NextSingleton = len(ss.Hashes)
+	}
+	s.printf("Filtered %d hashes to %d in %d trials\n", before, len(set), trials)
+
+	s.printf("Confirming filtered hash set triggers failure:\n")
+	ss.trySuffix(ss.Suffix)
+}
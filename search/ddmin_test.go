@@ -0,0 +1,205 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// letters returns the first n of a, b, c, ....
+func letters(n int) []string {
+	var set []string
+	for i := 0; i < n; i++ {
+		set = append(set, string(rune('a'+i)))
+	}
+	return set
+}
+
+// needs returns a fails function for sets that contain all of need.
+func needs(need ...string) func([]string) bool {
+	return func(set []string) bool {
+		have := make(map[string]bool)
+		for _, x := range set {
+			have[x] = true
+		}
+		for _, x := range need {
+			if !have[x] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// needsAny returns a fails function for sets that contain at least
+// k of some.
+func needsAny(k int, some ...string) func([]string) bool {
+	return func(set []string) bool {
+		n := 0
+		for _, x := range set {
+			for _, y := range some {
+				if x == y {
+					n++
+				}
+			}
+		}
+		return n >= k
+	}
+}
+
+var minimizeTests = []struct {
+	name   string
+	set    []string
+	fails  func([]string) bool
+	want   []string
+	trials int // distinct trials minimize takes
+}{
+	{"all needed", letters(4), needs(letters(4)...), letters(4), 4},
+	{"one needed", letters(16), needs("k"), []string{"k"}, 7},
+	{"first needed", letters(8), needs("a"), []string{"a"}, 4},
+	{"two needed", letters(16), needs("c", "n"), []string{"c", "n"}, 24},
+	{"two of three", letters(8), needsAny(2, "b", "e", "g"), nil, 13},
+	{"one element", letters(1), needs("a"), letters(1), 0},
+	{"any element", letters(8), needsAny(1, letters(8)...), nil, 3},
+}
+
+// checkMinimal checks that got is a 1-minimal failing subset of set,
+// in set's order.
+func checkMinimal(t *testing.T, set, got []string, fails func([]string) bool) {
+	t.Helper()
+	if !fails(got) {
+		t.Fatalf("result %v does not fail", got)
+	}
+	for i := range got {
+		c := append(append([]string(nil), got[:i]...), got[i+1:]...)
+		if len(c) > 0 && fails(c) {
+			t.Errorf("result %v is not 1-minimal: %v also fails", got, c)
+		}
+	}
+	j := 0
+	for _, x := range got {
+		for j < len(set) && set[j] != x {
+			j++
+		}
+		if j == len(set) {
+			t.Fatalf("result %v is not a subset of %v in order", got, set)
+		}
+		j++
+	}
+}
+
+// counting wraps fails to count its calls, which must not be on
+// empty sets or repeated.
+func counting(t *testing.T, fails func([]string) bool) (func([]string) bool, *int) {
+	trials := 0
+	seen := make(map[string]bool)
+	return func(set []string) bool {
+		t.Helper()
+		if len(set) == 0 {
+			t.Fatalf("fails called on the empty set")
+		}
+		key := strings.Join(set, ",")
+		if !seen[key] {
+			seen[key] = true
+			trials++
+		}
+		return fails(set)
+	}, &trials
+}
+
+func TestDdmin(t *testing.T) {
+	for _, test := range minimizeTests {
+		t.Run(test.name, func(t *testing.T) {
+			fails, _ := counting(t, test.fails)
+			got := ddmin(test.set, fails)
+			checkMinimal(t, test.set, got, test.fails)
+			if test.want != nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ddmin = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	for _, test := range minimizeTests {
+		t.Run(test.name, func(t *testing.T) {
+			fails, trials := counting(t, test.fails)
+			got := minimize(test.set, fails)
+			checkMinimal(t, test.set, got, test.fails)
+			if test.want != nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("minimize = %v, want %v", got, test.want)
+			}
+			if *trials != test.trials {
+				t.Errorf("minimize took %d distinct trials, want %d", *trials, test.trials)
+			}
+		})
+	}
+}
+
+// TestMinimizeAllNeeded checks that when nothing can be removed,
+// minimize tries each removal once and nothing else.
+func TestMinimizeAllNeeded(t *testing.T) {
+	for n := 1; n <= 10; n++ {
+		set := letters(n)
+		var calls []string
+		fails := func(subset []string) bool {
+			calls = append(calls, strings.Join(subset, ""))
+			return len(subset) == n
+		}
+		got := minimize(set, fails)
+		if !reflect.DeepEqual(got, set) {
+			t.Errorf("minimize(%v) = %v", set, got)
+		}
+		want := n
+		if n == 1 {
+			want = 0 // never the empty set
+		}
+		if len(calls) != want {
+			t.Errorf("minimize(%v) took %d trials, want %d: %v", set, len(calls), want, calls)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for n := 1; n <= 8; n++ {
+		for k := 1; k <= n; k++ {
+			chunks := split(letters(n), k)
+			if len(chunks) != k {
+				t.Fatalf("split(%d, %d) made %d chunks", n, k, len(chunks))
+			}
+			var all []string
+			for i, c := range chunks {
+				if len(c) == 0 {
+					t.Errorf("split(%d, %d) chunk %d is empty", n, k, i)
+				}
+				if d := len(c) - n/k; d < 0 || d > 1 {
+					t.Errorf("split(%d, %d) chunk %d has %d elements", n, k, i, len(c))
+				}
+				all = append(all, c...)
+			}
+			if got := fmt.Sprint(all); got != fmt.Sprint(letters(n)) {
+				t.Errorf("split(%d, %d) = %v", n, k, chunks)
+			}
+			for i := range chunks {
+				if c := complement(chunks, i); len(c) != n-len(chunks[i]) {
+					t.Errorf("complement(split(%d, %d), %d) = %v", n, k, i, c)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A TestEvent is one line of the output of go test -json
+// (see go doc cmd/test2json).
+type TestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// TestResults returns the result of each test in output, a go test
+// -json stream, by test name: "pass", "fail", "skip", or "run" for a
+// test that started but never finished (because the test binary
+// crashed or was killed).  A test that ran in more than one package,
+// or more than once, has the worst of its results.  Lines that are not
+// test events, such as build errors, are ignored.
+func TestResults(output []byte) map[string]string {
+	rank := map[string]int{"skip": 1, "pass": 2, "run": 3, "fail": 4}
+	results := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var e TestEvent
+		if err := json.Unmarshal(line, &e); err != nil || e.Test == "" {
+			continue
+		}
+		switch e.Action {
+		case "run":
+			if results[e.Test] == "" {
+				results[e.Test] = "run"
+			}
+		case "pass", "fail", "skip":
+			if r := results[e.Test]; r == "run" || rank[e.Action] > rank[r] {
+				results[e.Test] = e.Action
+			}
+		}
+	}
+	return results
+}
+
+// TestOutput returns the text of output, a go test -json stream, with
+// each event replaced by its output, as go test would have printed it
+// without -json.  Lines that are not events are kept as they are.
+func TestOutput(output []byte) []byte {
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e TestEvent
+		if t := bytes.TrimSpace(line); len(t) > 0 && t[0] == '{' && json.Unmarshal(t, &e) == nil && e.Action != "" {
+			b.WriteString(e.Output)
+			continue
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// testFailures returns the names of the tests in results that failed,
+// or did not finish, in order.
+func testFailures(results map[string]string) []string {
+	var failed []string
+	for name, r := range results {
+		if r == "fail" || r == "run" {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// classifyTests decides, from the results of a go test -json
+// command, whether one of the tests matching tests failed, whether
+// none of them ran, making the outcome unrelated, and whether they
+// were all skipped, and describes why.
+func classifyTests(results map[string]string, tests *regexp.Regexp) (failed, unrelated, skipped bool, why string) {
+	byResult := make(map[string][]string)
+	for name, r := range results {
+		if tests.MatchString(name) {
+			byResult[r] = append(byResult[r], name)
+		}
+	}
+	for _, names := range byResult {
+		sort.Strings(names)
+	}
+	switch {
+	case len(byResult["fail"]) > 0 || len(byResult["run"]) > 0:
+		names := append(byResult["fail"], byResult["run"]...)
+		return true, false, false, "failed " + strings.Join(names, ", ")
+	case len(byResult["pass"]) > 0:
+		return false, false, false, "passed " + strings.Join(byResult["pass"], ", ")
+	case len(byResult["skip"]) > 0:
+		return false, false, true, "skipped " + strings.Join(byResult["skip"], ", ")
+	}
+	return false, true, false, fmt.Sprintf("no test matching %q ran", tests)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const testJSON = `# example.com/p [build output]
+{"Action":"start","Package":"example.com/p"}
+{"Action":"run","Package":"example.com/p","Test":"TestA"}
+{"Action":"output","Package":"example.com/p","Test":"TestA","Output":"gossahash triggered f 0101\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestA"}
+{"Action":"run","Package":"example.com/p","Test":"TestB"}
+{"Action":"pass","Package":"example.com/p","Test":"TestB"}
+{"Action":"run","Package":"example.com/q","Test":"TestB"}
+{"Action":"skip","Package":"example.com/q","Test":"TestB"}
+{"Action":"run","Package":"example.com/p","Test":"TestC"}
+{"Action":"fail","Package":"example.com/p"}
+`
+
+func TestTestResults(t *testing.T) {
+	want := map[string]string{"TestA": "fail", "TestB": "pass", "TestC": "run"}
+	if got := TestResults([]byte(testJSON)); !reflect.DeepEqual(got, want) {
+		t.Errorf("TestResults = %v, want %v", got, want)
+	}
+}
+
+func TestTestOutput(t *testing.T) {
+	want := "# example.com/p [build output]\ngossahash triggered f 0101\n"
+	if got := string(TestOutput([]byte(testJSON))); got != want {
+		t.Errorf("TestOutput = %q, want %q", got, want)
+	}
+}
+
+func TestClassifyTests(t *testing.T) {
+	results := TestResults([]byte(testJSON))
+	tests := []struct {
+		tests                      string
+		failed, unrelated, skipped bool
+		why                        string
+	}{
+		{"TestA", true, false, false, "failed TestA"},
+		{"TestC", true, false, false, "failed TestC"},
+		{"Test[AC]", true, false, false, "failed TestA, TestC"},
+		{"TestB", false, false, false, "passed TestB"},
+		{"TestD", false, true, false, `no test matching "TestD" ran`},
+	}
+	for _, test := range tests {
+		failed, unrelated, skipped, why := classifyTests(results, regexp.MustCompile(test.tests))
+		if failed != test.failed || unrelated != test.unrelated || skipped != test.skipped || why != test.why {
+			t.Errorf("classifyTests(%q) = %v, %v, %v, %q, want %v, %v, %v, %q", test.tests,
+				failed, unrelated, skipped, why, test.failed, test.unrelated, test.skipped, test.why)
+		}
+	}
+
+	skips := map[string]string{"TestS": "skip", "TestT": "skip"}
+	if _, _, skipped, why := classifyTests(skips, regexp.MustCompile("Test")); !skipped || why != "skipped TestS, TestT" {
+		t.Errorf("classifyTests of skipped tests = %v, %q", skipped, why)
+	}
+}
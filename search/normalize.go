@@ -0,0 +1,61 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A Rewrite normalizes trigger lines before distinct triggers are
+// counted, by replacing text that matches Pattern with Replacement
+// (as in regexp.ReplaceAllString), so that text that varies from run
+// to run, such as temporary directory names, does not make one
+// trigger look like several.
+type Rewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// DefaultRewrites replaces the go command's temporary work
+// directories (e.g., /tmp/go-build123456/b001/) with $WORK/, as
+// go build -x does, and process IDs (e.g., pid=1234) with pid=N.
+var DefaultRewrites = []Rewrite{
+	{regexp.MustCompile(`[^\s'"=]*/go-build[0-9]+/`), "$$WORK/"},
+	{regexp.MustCompile(`\b(pid|PID)([ =:]*)[0-9]+\b`), "${1}${2}N"},
+}
+
+// ParseRewrite parses a rewrite written as REGEX=REPLACEMENT.  The
+// regular expression ends at the last '=', so only it may contain '='.
+func ParseRewrite(s string) (Rewrite, error) {
+	i := strings.LastIndex(s, "=")
+	if i == -1 {
+		return Rewrite{}, fmt.Errorf("normalization %q is not of the form REGEX=REPLACEMENT", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return Rewrite{}, err
+	}
+	return Rewrite{Pattern: re, Replacement: s[i+1:]}, nil
+}
+
+// normalize applies rewrites to s, in order.
+func normalize(s string, rewrites []Rewrite) string {
+	for _, r := range rewrites {
+		s = r.Pattern.ReplaceAllString(s, r.Replacement)
+	}
+	return s
+}
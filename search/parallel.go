@@ -0,0 +1,105 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"context"
+)
+
+// A pending trial is running (or waiting for a worker) in the background.
+type pending struct {
+	t      *Trial
+	cancel context.CancelFunc
+	done   chan struct{} // closed when o is set
+	o      *Outcome
+}
+
+// trial returns the Trial for running ss with suffix.  The Trial has
+// its own copy of ss's hashes, which the search changes while
+// speculative trials run.
+func (ss *State) trial(suffix string) *Trial {
+	s := ss.s
+	hashes := append([]string{}, ss.Hashes...)
+	return &Trial{Env: ss.envFor(suffix, !ss.WithoutExcludes), Name: s.name, Suffix: suffix, Hashes: hashes, opts: &s.opts}
+}
+
+// run waits for a free worker and runs t on it.  It returns nil if
+// ctx is canceled before a worker becomes free.
+func (s *Searcher) run(ctx context.Context, t *Trial) *Outcome {
+	var w int
+	select {
+	case w = <-s.workers:
+	case <-ctx.Done():
+		return nil
+	}
+	defer func() { s.workers <- w }()
+	t.Worker = w
+	return s.vote(ctx, t)
+}
+
+// speculation returns the suffixes worth trying in advance of
+// searching below confirmed, with arm a+confirmed first, then arm
+// b+confirmed, then depth further levels of the tree beneath both.
+func speculation(a, b, confirmed string, depth int) []string {
+	level := []string{a + confirmed, b + confirmed}
+	suffixes := append([]string{}, level...)
+	for ; depth > 0; depth-- {
+		var next []string
+		for _, x := range level {
+			next = append(next, "0"+x, "1"+x)
+		}
+		suffixes = append(suffixes, next...)
+		level = next
+	}
+	return suffixes
+}
+
+// speculate starts background trials for suffixes that are not
+// already pending, and cancels pending trials that are no longer
+// wanted.  speculate(nil) cancels everything.
+func (ss *State) speculate(suffixes []string) {
+	if len(ss.s.replaying) > 0 {
+		// The recorded outcomes will be used instead.
+		suffixes = nil
+	}
+	wanted := make(map[string]*Trial)
+	var order []*Trial
+	for _, x := range suffixes {
+		t := ss.trial(x)
+		wanted[t.Env] = t
+		order = append(order, t)
+	}
+	for env, p := range ss.pending {
+		if wanted[env] == nil {
+			p.cancel()
+			delete(ss.pending, env)
+		}
+	}
+	if ss.pending == nil {
+		ss.pending = make(map[string]*pending)
+	}
+	for _, t := range order {
+		if ss.pending[t.Env] != nil || ss.s.cached(t) != nil {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		p := &pending{t: t, cancel: cancel, done: make(chan struct{})}
+		ss.pending[t.Env] = p
+		go func() {
+			p.o = ss.s.run(ctx, p.t)
+			close(p.done)
+		}()
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// TestParallelSearch runs multiple-point searches with more than one
+// job, which share nothing with their speculative trials; run it with
+// -race.
+func TestParallelSearch(t *testing.T) {
+	failures := [][]string{{"f3", "f150"}}
+	for _, lookahead := range []int{0, 1} {
+		for seed := int64(1); seed < 30; seed++ {
+			sim := &simulation{points: points(fNames(200)...), failures: failures}
+			s := New(sim, Options{
+				EnvPrefix: "GOCOMPILEDEBUG=",
+				HashVar:   "gossahash",
+				Multiple:  1,
+				Jobs:      2,
+				Lookahead: lookahead,
+				Seed:      seed,
+				Out:       ioutil.Discard,
+			})
+			sss := s.Run("", "")
+			if got, want := sim.found(sss), []string{"f150+f3"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("lookahead %d, seed %d: found %v, want %v", lookahead, seed, got, want)
+			}
+		}
+	}
+}
+
+// fNames returns the names f0, f1, ... of n points.
+func fNames(n int) []string {
+	var names []string
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("f%d", i))
+	}
+	return names
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by Preflight, wrapped with the details.
+var (
+	ErrFailsWithNone = errors.New("the test fails with nothing enabled")
+	ErrPassesWithAll = errors.New("the test passes with everything enabled")
+	ErrNoTriggers    = errors.New("no triggers were reported")
+	ErrUnrelated     = errors.New("the test fails in an unrelated way")
+)
+
+// Preflight checks that the test is set up for a search starting at
+// initialSuffix (as for Run), which assumes that the test fails with
+// everything matching initialSuffix enabled, except for excluded
+// suffixes (pattern "y", if both are empty), passes with nothing
+// enabled ("n"), and reports triggers.  It runs both configurations,
+// and returns an error describing the first problem found, or nil.
+func (s *Searcher) Preflight(initialSuffix string) error {
+	ev := fmt.Sprintf("%s%s=%s", s.opts.EnvPrefix, s.opts.HashVar, s.opts.HashPrefix)
+	if s.opts.BisectPattern {
+		ev += "v"
+	}
+	t := s.NewState().trial(initialSuffix)
+	if initialSuffix == "" && len(s.excludes) == 0 {
+		// An empty setting usually turns hash matching off
+		// altogether, leaving everything enabled but unreported.
+		t.Env = ev + "y"
+	}
+	all := t.Env
+	s.printf("Preflight: checking that the test fails with everything enabled, and passes with nothing enabled\n")
+
+	trials := []*Trial{t, s.noneTrial()}
+	none := trials[1].Env
+	outcomes := make([]*Outcome, len(trials))
+	done := make(chan struct{})
+	for i, t := range trials {
+		go func(i int, t *Trial) {
+			outcomes[i] = s.try(t)
+			done <- struct{}{}
+		}(i, t)
+	}
+	for range trials {
+		<-done
+	}
+	y, n := outcomes[0], outcomes[1]
+	s.baseline = n
+
+	switch {
+	case y.Unrelated:
+		return fmt.Errorf("%w with everything enabled (%s): %s", ErrUnrelated, all, y.Why)
+	case y.Skipped:
+		return fmt.Errorf("%w: with everything enabled (%s), the test could not tell whether it failed: %s", ErrPassesWithAll, all, y.Why)
+	case !y.Failed:
+		return fmt.Errorf("%w (%s); either the failure did not occur, or the hash setting does not reach the code being searched", ErrPassesWithAll, all)
+	case len(y.Triggers) == 0 && len(y.Output) == 0:
+		return fmt.Errorf("%w with everything enabled (%s), and there was no output to report them", ErrNoTriggers, all)
+	case len(y.Triggers) == 0:
+		return fmt.Errorf("%w with everything enabled (%s); the output has no '%s triggered' lines or bisect markers", ErrNoTriggers, all, s.name)
+	case n.Unrelated:
+		return fmt.Errorf("%w with nothing enabled (%s): %s", ErrUnrelated, none, n.Why)
+	case n.Failed:
+		return fmt.Errorf("%w (%s): %s; the failure does not depend on the hash, or the test is inverted", ErrFailsWithNone, none, n.Why)
+	}
+	// A program following the bisect protocol may print markers for
+	// changes that it considers but does not enable, so with pattern
+	// "vn" triggers are no sign of trouble.
+	if len(n.Triggers) > 0 && !s.opts.BisectPattern {
+		s.printf("Preflight: %d triggers were reported with nothing enabled (%s); the program may not understand pattern \"n\"\n", len(n.Triggers), none)
+	}
+	s.printf("Preflight: ok, %d triggers with everything enabled\n", len(y.Triggers))
+	return nil
+}
+
+// Baseline returns the outcome of the test with nothing enabled
+// (pattern "n"), which Preflight also checks, running it if that has
+// not been done already.
+func (s *Searcher) Baseline() *Outcome {
+	if s.baseline == nil {
+		s.baseline = s.try(s.noneTrial())
+	}
+	return s.baseline
+}
+
+// noneTrial returns the trial with nothing enabled.
+func (s *Searcher) noneTrial() *Trial {
+	ev := fmt.Sprintf("%s%s=%s", s.opts.EnvPrefix, s.opts.HashVar, s.opts.HashPrefix)
+	if s.opts.BisectPattern {
+		ev += "v"
+	}
+	return &Trial{Env: ev + "n", Name: s.name, opts: &s.opts}
+}
+
+// try returns the cached outcome of t, or runs it.
+func (s *Searcher) try(t *Trial) *Outcome {
+	o := s.cached(t)
+	if o == nil {
+		o = s.run(context.Background(), t)
+		s.cache(t, o)
+	}
+	return o
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name   string
+		y, n   func(o *Outcome) // change the outcomes with everything and nothing enabled
+		bisect bool
+		err    error
+		warn   bool // warn that the program may not understand "n"
+	}{
+		{name: "ok"},
+		{name: "ok, bisect pattern", bisect: true},
+		{name: "passes with all", y: func(o *Outcome) { o.Failed = false }, err: ErrPassesWithAll},
+		{name: "skipped with all", y: func(o *Outcome) { o.Failed, o.Skipped = false, true }, err: ErrPassesWithAll},
+		{name: "unrelated with all", y: func(o *Outcome) { o.Failed, o.Unrelated = false, true }, err: ErrUnrelated},
+		{name: "no output", y: func(o *Outcome) { o.Output, o.Triggers = nil, nil }, err: ErrNoTriggers},
+		{name: "no triggers", y: func(o *Outcome) { o.Triggers = nil }, err: ErrNoTriggers},
+		{name: "fails with none", n: func(o *Outcome) { o.Failed = true }, err: ErrFailsWithNone},
+		{name: "unrelated with none", n: func(o *Outcome) { o.Unrelated = true }, err: ErrUnrelated},
+		{name: "triggers with none", n: func(o *Outcome) { o.Triggers = map[string]int{"0x1": 1} }, warn: true},
+		{name: "triggers with none, bisect pattern", n: func(o *Outcome) { o.Triggers = map[string]int{"0x1": 1} }, bisect: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sim := &simulation{points: points(fNames(20)...), failures: [][]string{{"f3"}}}
+			oracle := OracleFunc(func(ctx context.Context, t *Trial) *Outcome {
+				o := sim.Try(ctx, t)
+				change := test.y
+				if strings.HasSuffix(t.Env, "n") {
+					change = test.n
+				}
+				if change != nil {
+					change(o)
+				}
+				return o
+			})
+			var narrative bytes.Buffer
+			s := New(oracle, Options{
+				EnvPrefix:     "GOCOMPILEDEBUG=",
+				HashVar:       "gossahash",
+				Bisect:        test.bisect,
+				BisectPattern: test.bisect,
+				Out:           &narrative,
+			})
+			err := s.Preflight("")
+			if !errors.Is(err, test.err) {
+				t.Errorf("Preflight = %v, want %v", err, test.err)
+			}
+			if warned := strings.Contains(narrative.String(), "may not understand"); warned != test.warn {
+				t.Errorf("warned = %v, want %v:\n%s", warned, test.warn, narrative.Bytes())
+			}
+			if s.Baseline() == nil {
+				t.Errorf("Preflight did not record the baseline")
+			}
+		})
+	}
+}
@@ -0,0 +1,768 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package search implements the gossahash hash-suffix search.
+//
+// A Searcher asks an Oracle to run a test with longer and longer hash
+// suffixes enabled, looking for the function (or set of functions)
+// whose treatment causes the test to fail.  Each Searcher carries all
+// of its own state, so several independent searches may run in one
+// process.
+package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+const (
+	FAILED    = iota // Script exited with return code > 0 and multiple functions SSA compiled.
+	DONE             // Script exited with return code > 0 and exactly one function SSA compiled.
+	DONE0            // Script exited with return code > 0 and no functions SSA compiled (means test is flaky)
+	PASSED           // Script exited with return code 0
+	PASSED0          // Script exited with return code 0 AND no functions SSA compiled.
+	UNRELATED        // Script failed, but not in the way being searched for.
+	SKIP             // Script could not tell whether it failed (e.g., exit code 125).
+)
+
+// Options configures a Searcher.
+type Options struct {
+	// EnvPrefix precedes the hash setting in the environment string
+	// given to the oracle, e.g., "GOCOMPILEDEBUG=" or "GODEBUG=".
+	// Other settings may be spliced in, as in "GOCOMPILEDEBUG=ssa/check/on,".
+	EnvPrefix string
+
+	// HashVar is the name/prefix of the variable communicating the
+	// hash suffix, e.g., "gossahash" or "loopvarhash".
+	HashVar string
+
+	// HashPrefix is prepended to all hash encodings, for special
+	// hash interpretation/debugging.
+	HashPrefix string
+
+	HashLimit    int      // Maximum length of a hash string, at most 64; zero means 30.
+	Excludes     []string // Exclude these suffixes from matching.
+	Multiple     int      // Stop after finding this many failures; zero means don't stop.
+	BatchExclude bool     // For repeated multi-point searches, exclude all points of a failure.
+	Bisect       bool     // Trigger lines use bisect syntax.
+
+	// Normalize rewrites trigger lines before distinct triggers are
+	// counted (see DefaultRewrites).
+	Normalize []Rewrite
+
+	// BisectPattern, if set, communicates the hash suffixes in the
+	// pattern syntax of the golang.org/x/tools/internal/bisect
+	// protocol (implies Bisect).
+	BisectPattern bool
+
+	// Jobs is the number of trials that may run at once; zero or
+	// one means one at a time.  With more than one, both arms of each
+	// step of the search are tried at once, and trials that become
+	// irrelevant are canceled.
+	Jobs int
+
+	// Lookahead is the number of additional levels of the search
+	// tree to try speculatively when Jobs is more than one.
+	Lookahead int
+
+	// Repeat is the number of times to run each configuration; the
+	// result is decided by vote.  Zero means once.
+	Repeat int
+
+	// FailThreshold is the fraction of repeated runs that must fail
+	// for a configuration to count as failing; zero means one half.
+	// When a single run could change the vote, up to twice Repeat
+	// runs are made.
+	FailThreshold float64
+
+	// Focus, if not empty, limits the search to one kind of failure:
+	// a failure counts only if its signature (see Outcome.Signature)
+	// contains Focus, and other failures count as passes.
+	Focus string
+
+	// Seed seeds the random choices of the search (which arm of a
+	// step to try first, and which hash to search next), so a search
+	// with the same seed and the same trial outcomes takes the same path.
+	Seed int64
+
+	// Checkpoint, if not empty, names a file where a Checkpoint is
+	// written after every trial.  CommandLine and Seed are recorded
+	// there, to help resume the search.
+	Checkpoint  string
+	CommandLine []string
+
+	// Resume, if not nil, is a checkpoint of an earlier run of this
+	// search; its trials are replayed rather than run again.
+	Resume *Checkpoint
+
+	// Cache, if not nil, supplies the outcomes of trials that have
+	// already been run, instead of running them again.  CacheKey
+	// identifies the test within the cache (e.g., CommandOracle.CacheKey),
+	// and should reflect everything but Options that affects outcomes.
+	// If Rerun is set, trials are always run (for flaky tests), and
+	// only their outcomes are added to the cache.
+	Cache    *Cache
+	CacheKey string
+	Rerun    bool
+
+	// LogPrefix is the prefix on PASS/FAIL log files; if empty,
+	// no log files are written.
+	LogPrefix string
+
+	// Out receives the narrative of the search; nil means os.Stdout.
+	Out io.Writer
+}
+
+// A Trial describes one run of the test.
+type Trial struct {
+	Env    string // The environment setting carrying the hash pattern, e.g. GOCOMPILEDEBUG=gossahash=-0110/101
+	Name   string // Name of the hash variable whose triggers are counted.
+	Suffix string // The hash suffix being tried.
+	Worker int    // Which of the Searcher's Jobs runs this trial, from 0.
+
+	// Hashes are the other hashes of a multiple-point trial, set for
+	// the variables Name0, Name1, and so on.
+	Hashes []string
+
+	opts *Options
+}
+
+// Match extracts the hash trigger reports for t from output.
+func (t *Trial) Match(output []byte) (map[string]int, string) {
+	bisect, rewrites := t.syntax()
+	return MatchTrigger(output, t.Name, t.Suffix, bisect, rewrites...)
+}
+
+// HashTriggers extracts the last trigger report for each of t's
+// Hashes from output, "" for a hash with none.
+func (t *Trial) HashTriggers(output []byte) []string {
+	if len(t.Hashes) == 0 {
+		return nil
+	}
+	bisect, rewrites := t.syntax()
+	triggers := make([]string, len(t.Hashes))
+	for i, h := range t.Hashes {
+		_, triggers[i] = MatchTrigger(output, fmt.Sprintf("%s%d", t.Name, i), h, bisect, rewrites...)
+	}
+	return triggers
+}
+
+// Collisions extracts the hashes reported for more than one distinct
+// name for t from output, with those names.
+func (t *Trial) Collisions(output []byte) map[string][]string {
+	bisect, rewrites := t.syntax()
+	return MatchCollisions(output, t.Name, t.Suffix, bisect, rewrites...)
+}
+
+// syntax returns whether t's trigger lines use bisect syntax, and how
+// they are normalized.
+func (t *Trial) syntax() (bool, []Rewrite) {
+	if t.opts == nil {
+		return false, nil
+	}
+	return t.opts.Bisect, t.opts.Normalize
+}
+
+// An Outcome is the result of running one Trial.
+type Outcome struct {
+	Failed       bool                // The test failed.
+	Unrelated    bool                // The test failed, but not in the way being searched for.
+	Skipped      bool                // The test could not tell whether it failed.
+	Why          string              // Description of the failure, e.g., "exit status 1".
+	Triggers     map[string]int      // Distinct trigger reports, with their counts.
+	LastTrigger  string              // Name from the last trigger report.
+	HashTriggers []string            `json:",omitempty"` // Last trigger report for each of the trial's Hashes.
+	Collisions   map[string][]string `json:",omitempty"` // Hashes reported for more than one name, with the names.
+	Crash        string              `json:",omitempty"` // Signature of a crash in the output (see CrashSignature).
+	FailedTests  []string            `json:",omitempty"` // Tests that failed, for go test -json commands.
+	ExitCode     int                 `json:",omitempty"` // Exit status of the command, -1 if it was killed.
+	Output       []byte              `json:"-"`          // Output of the test, saved in log files; not recorded.
+
+	Runs  int // Number of runs that passed or failed, if repeated.
+	Fails int // Number of those runs that failed.
+}
+
+// An Oracle runs the test for a Trial and reports the outcome.
+// If the Searcher runs more than one job, Try is called concurrently,
+// but never concurrently for the same Trial.Worker.  If ctx is
+// canceled, the trial is no longer needed and its outcome is ignored.
+type Oracle interface {
+	Try(ctx context.Context, t *Trial) *Outcome
+}
+
+// OracleFunc adapts an ordinary function to the Oracle interface.
+type OracleFunc func(ctx context.Context, t *Trial) *Outcome
+
+func (f OracleFunc) Try(ctx context.Context, t *Trial) *Outcome {
+	return f(ctx, t)
+}
+
+// A Searcher searches for failure-inducing hash suffixes.
+type Searcher struct {
+	opts     Options
+	oracle   Oracle
+	name     string   // HashVar up to any "=", used to match trigger lines.
+	excludes []string // hashes already seen to fail, now excluded
+	workers  chan int // free worker numbers
+	flakes   []Flake  // configurations that both passed and failed
+
+	unrelated []*Record // trials that failed for unrelated reasons
+	baseline  *Outcome  // outcome with nothing enabled, once known
+
+	states    []*State  // states of this search, for checkpoints
+	trials    []*Record // trials of this search, for checkpoints
+	replaying []*Record // trials remaining to be replayed from Options.Resume
+
+	rng *rand.Rand // source of the search's random choices, from Options.Seed
+}
+
+// New returns a Searcher that consults oracle to run each trial.
+func New(oracle Oracle, opts Options) *Searcher {
+	if opts.HashLimit == 0 {
+		opts.HashLimit = 30
+	} else if opts.HashLimit > 64 {
+		opts.HashLimit = 64
+	}
+	if opts.BisectPattern {
+		opts.Bisect = true
+	}
+	if opts.FailThreshold <= 0 {
+		opts.FailThreshold = 0.5
+	} else if opts.FailThreshold > 1 {
+		opts.FailThreshold = 1
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	s := &Searcher{opts: opts, oracle: oracle, rng: rand.New(rand.NewSource(opts.Seed))}
+	s.name = opts.HashVar
+	if i := strings.Index(s.name, "="); i != -1 {
+		s.name = s.name[:i]
+	}
+	s.excludes = append(s.excludes, opts.Excludes...)
+	if opts.Jobs < 1 {
+		s.opts.Jobs = 1
+	}
+	if opts.Resume != nil {
+		s.replaying = opts.Resume.Trials
+	}
+	s.workers = make(chan int, s.opts.Jobs)
+	for i := 0; i < s.opts.Jobs; i++ {
+		s.workers <- i
+	}
+	return s
+}
+
+// Name returns the name of the hash variable, as it appears in trigger lines.
+func (s *Searcher) Name() string {
+	return s.name
+}
+
+// Bisect reports whether trigger lines use bisect syntax.
+func (s *Searcher) Bisect() bool {
+	return s.opts.Bisect
+}
+
+func (s *Searcher) printf(format string, a ...interface{}) {
+	fmt.Fprintf(s.opts.Out, format, a...)
+}
+
+// Unrelated returns the trials that failed, but not in the way
+// being searched for, in the order they were tried.
+func (s *Searcher) Unrelated() []*Record {
+	return s.unrelated
+}
+
+// what returns a name for the test being run, for narrative output.
+func (s *Searcher) what() string {
+	if st, ok := s.oracle.(fmt.Stringer); ok {
+		return st.String()
+	}
+	return "test"
+}
+
+// NewState returns an empty search state for s.
+func (s *Searcher) NewState() *State {
+	return &State{s: s}
+}
+
+// saveLogFiles stores data in filename, unless it cannot
+// in which case it whines (but still returns).
+// The default permission on the file name is conservative
+// because "you never know".
+func saveLogFile(filename string, data []byte) {
+	error := ioutil.WriteFile(filename, data, 0600)
+	if error != nil {
+		fmt.Fprintf(os.Stderr, "Error saving log file %s\n", error)
+	}
+}
+
+// State is the state of a single search; one State is
+// produced for each failure that is found.
+type State struct {
+	Suffix string
+
+	// The accumulated list of hashes that are either proven
+	// singleton triggers that contribute to failure, or proven/
+	// inferred to trigger at least one SSA-compilation that
+	// contributes to failure.
+	Hashes []string
+
+	// hashes before  this index correspond to a single function
+	// whose compilation is necessary to trigger a failure.
+	// This counter advances as new singleton-triggering hashes
+	// are found.
+	NextSingleton int
+
+	LastTrigger     string
+	HashTriggers    []string `json:",omitempty"` // Last trigger for each of Hashes in the last failing trial.
+	Crash           string   `json:",omitempty"` // Crash signature of the last failing trial.
+	FailedTests     []string `json:",omitempty"` // Tests that failed in the last failing trial.
+	Signature       string   `json:",omitempty"` // Signature of the last failing trial.
+	WithoutExcludes bool     // initially, false == "with excludes"
+
+	// Collisions maps each suffix or hash of the failure whose full
+	// hash was reported for more than one distinct name (a hash
+	// collision) to those names, which cannot be told apart.
+	Collisions map[string][]string `json:",omitempty"`
+
+	// Parts of the search that could not be tested, not yet
+	// searched, in case the path searched instead is a dead end.
+	Alternatives []*Alternative
+
+	s         *Searcher
+	pending   map[string]*pending // speculative trials, by environment
+	lastCount int                 // number of distinct triggers in the last trial
+	failed    bool                // some trial has failed, setting Crash
+}
+
+// An Alternative is an untested part of a search, and the hashes
+// that went with it.
+type Alternative struct {
+	Suffix        string
+	Hashes        []string
+	NextSingleton int
+}
+
+// alternative returns suffix as an alternative to the current search.
+func (ss *State) alternative(suffix string) *Alternative {
+	return &Alternative{Suffix: suffix, Hashes: append([]string{}, ss.Hashes...), NextSingleton: ss.NextSingleton}
+}
+
+// backtrack resumes the most recent alternative, and returns its
+// suffix, or returns "", false if there is none.
+func (ss *State) backtrack() (string, bool) {
+	if len(ss.Alternatives) == 0 {
+		return "", false
+	}
+	alt := ss.Alternatives[len(ss.Alternatives)-1]
+	ss.Alternatives = ss.Alternatives[:len(ss.Alternatives)-1]
+	ss.Hashes = alt.Hashes
+	ss.NextSingleton = alt.NextSingleton
+	ss.s.printf("Dead end, backtracking to untested %s\n", alt.Suffix)
+	return alt.Suffix, true
+}
+
+// collision notes whether the single hash triggered by the failing
+// suffix was reported for more than one name.
+func (ss *State) collision(suffix string, o *Outcome) {
+	for h := range o.Triggers {
+		names := o.Collisions[h]
+		if len(names) < 2 {
+			return
+		}
+		ss.s.printf("Hash collision, %d distinct triggers share hash %s:\n", len(names), h)
+		for _, n := range names {
+			ss.s.printf("\t%s\n", n)
+		}
+		if ss.Collisions == nil {
+			ss.Collisions = make(map[string][]string)
+		}
+		ss.Collisions[suffix] = names
+	}
+}
+
+var sep = "/"
+
+// Env returns the environment setting that enables ss's suffix and
+// hashes, optionally excluding the hashes of failures already found.
+func (ss *State) Env(withExcludes bool) string {
+	return ss.envFor(ss.Suffix, withExcludes)
+}
+
+func (ss *State) envFor(suffix string, withExcludes bool) string {
+	s := ss.s
+	ev := fmt.Sprintf("%s%s=%s", s.opts.EnvPrefix, s.opts.HashVar, s.opts.HashPrefix)
+	if s.opts.BisectPattern {
+		var excludes []string
+		if withExcludes {
+			excludes = s.excludes
+		}
+		return ev + bisectPattern(suffix, ss.Hashes, excludes)
+	}
+	if withExcludes {
+		for _, x := range s.excludes {
+			ev += "-" + x + sep
+		}
+	}
+	ev += suffix
+	for i := 0; i < len(ss.Hashes); i++ {
+		ev += fmt.Sprintf("%s%s", sep, ss.Hashes[i])
+	}
+	return ev
+}
+
+// ParseExcludes splits a list (space, comma, +, or - separated)
+// of binary suffixes.
+func ParseExcludes(x string) []string {
+	if x == "" {
+		return nil
+	}
+	var xs []string
+	var a string
+	for _, c := range x {
+		switch c {
+		case '0', '1':
+			a = a + string(c)
+		case ' ', ',', '-', '+':
+			if len(a) > 0 {
+				xs = append(xs, a)
+				a = ""
+			}
+		}
+	}
+	if len(a) > 0 {
+		xs = append(xs, a)
+	}
+	return xs
+}
+
+// trySuffix runs the test command passing it suffix as an argument,
+// and returns PASSED/FAILED/DONE/DONE0 based on return code and occurrences
+// of the function_selection_string within the output; if there is only
+// one and the command fails, then the search is done.
+// Appropriate log files and narrative are also produced.
+func (ss *State) trySuffix(suffix string) int {
+	s := ss.s
+	ss.Suffix = suffix
+	t := ss.trial(suffix)
+	o := s.replay(t)
+	if o == nil {
+		if o = s.cached(t); o != nil {
+			s.printf("Reusing earlier result: %s\n", t.Env)
+		}
+	}
+	if p := ss.pending[t.Env]; o == nil && p != nil {
+		delete(ss.pending, t.Env)
+		<-p.done
+		o = p.o
+	}
+	if o == nil {
+		o = s.run(context.Background(), t)
+	}
+	s.cache(t, o)
+	s.record(t, o)
+	output := o.Output
+
+	// Compilations sometimes occur more than once, so stuff the
+	// matching string into a map. Note the map contains the whole
+	// line, so varying output not included in the hash can prevent
+	// convergence on a single trigger line.
+	ss.LastTrigger = o.LastTrigger
+	count := len(o.Triggers)
+	ss.lastCount = count
+
+	prefix := ""
+
+	if o.Runs > 1 {
+		s.printf("%d of %d runs failed\n", o.Fails, o.Runs)
+		if o.Fails > 0 && o.Fails < o.Runs {
+			s.flakes = append(s.flakes, Flake{Env: t.Env, Suffix: suffix, Runs: o.Runs, Fails: o.Fails})
+		}
+	}
+
+	if o.Skipped {
+		s.printf("%s %sskipped (%d distinct triggers): %s\n", s.what(), prefix, count, o.Why)
+		return SKIP
+	}
+
+	if o.Unrelated {
+		s.printf("%s %sunrelated failure (%d distinct triggers): %s\n", s.what(), prefix, count, o.Why)
+		if s.opts.LogPrefix != "" {
+			lfn := fmt.Sprintf("%s%sUNRELATED.%d.log", s.opts.LogPrefix, prefix, len(s.unrelated))
+			saveLogFile(lfn, output)
+			s.printf("Review %s for %sunrelated failure\n", lfn, prefix)
+		}
+		s.unrelated = append(s.unrelated, &Record{Env: t.Env, Outcome: o})
+		return UNRELATED
+	}
+
+	if o.Failed {
+		// we like errors.
+		s.printf("%s %sfailed (%d distinct triggers): %s\n", s.what(), prefix, count, o.Why)
+		if o.Crash != "" {
+			s.printf("Crash: %s\n", o.Crash)
+		}
+		if ss.failed && o.Crash != ss.Crash {
+			s.printf("WARNING: crash signature changed, was %q, now %q; is this the same failure?\n", ss.Crash, o.Crash)
+		}
+		ss.failed = true
+		ss.Crash = o.Crash
+		ss.FailedTests = o.FailedTests
+		ss.Signature = o.Signature()
+		ss.HashTriggers = o.HashTriggers
+		lfn := ""
+		if s.opts.LogPrefix != "" {
+			lfn = fmt.Sprintf("%s%sFAIL.%d.log", s.opts.LogPrefix, prefix, ss.NextSingleton)
+			saveLogFile(lfn, output)
+		}
+		if count == 1 {
+			ss.collision(suffix, o)
+		}
+		if count <= 1 {
+			if lfn != "" {
+				s.printf("Review %s for %sfailing run\n", lfn, prefix)
+			}
+			if count == 0 {
+				return DONE0
+			}
+			return DONE
+		}
+		return FAILED
+	}
+	if s.opts.LogPrefix != "" {
+		saveLogFile(s.opts.LogPrefix+prefix+"PASS.log", output)
+	}
+	if count == 0 {
+		return PASSED0
+	}
+	return PASSED
+}
+
+// Run searches for up to s's Multiple failures, beginning at
+// initialSuffix, which is assumed to fail.  If restartSuffix is not
+// empty, the search begins there instead (see the -R flag).  Run
+// returns the state of each failure that was found.
+func (s *Searcher) Run(initialSuffix, restartSuffix string) []*State {
+	multiple := s.opts.Multiple
+	sss := []*State{}
+	ss := s.NewState()
+	s.states = append(s.states, ss)
+	if restartSuffix != "" {
+		initialSuffix = restartSuffix[1:]
+		restartSuffix = restartSuffix[:1]
+	}
+	for {
+		if !ss.search(initialSuffix, restartSuffix) {
+			s.printf("FLAKY TEST OR BAD SEARCH\n")
+			break
+		} else {
+			sss = append(sss, ss)
+			// clean up multiple hash matches; this gives better output,
+			// also makes excludes more precise when reporting multiple errors.
+			ss.WithoutExcludes = true
+			ss.filter()
+
+			multiple--
+			if multiple == 0 {
+				break
+			}
+			s.excludes = append(s.excludes, ss.Suffix)
+			if s.opts.BatchExclude {
+				s.excludes = append(s.excludes, ss.Hashes...)
+			}
+			ss = s.NewState()
+			s.states = append(s.states, ss)
+			result := ss.trySuffix(initialSuffix)
+			if result == PASSED || result == PASSED0 || result == UNRELATED {
+				s.printf("NO MORE FAILURES\n")
+				break
+			}
+		}
+	}
+	return sss
+}
+
+func (ss *State) search(confirmed_suffix, restart_suffix string) bool {
+	s := ss.s
+	defer ss.speculate(nil)
+	// confirmed_suffix is a suffix that is confirmed
+	// to contain a failure.  The first confirmation is
+	// assumed to have occurred externally before this
+	// program was run.
+	// The search restarts from here if it excludes an untestable trigger.
+	start := ss.alternative(confirmed_suffix)
+	for len(confirmed_suffix) < s.opts.HashLimit {
+		a := "0"
+		b := "1"
+
+		if restart_suffix == "" && 0 == 8192&s.rng.Int() || restart_suffix == "1" {
+			a, b = b, a
+			restart_suffix = ""
+		}
+		if s.opts.Jobs > 1 {
+			ss.speculate(speculation(a, b, confirmed_suffix, s.opts.Lookahead))
+		}
+		first_result := ss.trySuffix(a + confirmed_suffix)
+		first_count := ss.lastCount
+		switch first_result {
+		case FAILED:
+			// Suffix is confirmed to contain a failure,
+			// but there is more than one match (function compiled)
+			// Record this confirmation and continue the search.
+			confirmed_suffix = ss.Suffix
+			continue
+
+		case PASSED0:
+		case PASSED:
+			// Suffix does not trigger a failure, so try
+			// prepending a "1" instead, below.
+		case DONE0:
+			// Treat this like a "pass" -- this hashcode is not useful for failure.
+		case UNRELATED:
+			// Something else went wrong; do not search into it.
+		case SKIP:
+			// Cannot tell; see what the b arm does.
+
+		case DONE:
+			// suffix caused exactly one function to be optimized
+			// and the test also failed.
+			if ss.NextSingleton == len(ss.Hashes) {
+				// In this case all confirmed searches have yielded
+				// singleton instances and we are done.
+				return true
+			}
+			// record this discovery and move on to the next one.
+			confirmed_suffix = ss.Hashes[ss.NextSingleton]
+			ss.Hashes[ss.NextSingleton] = ss.Suffix
+			ss.NextSingleton++
+			continue
+		}
+
+		// The a arm contained no failures, try the b arm.
+		result := ss.trySuffix(b + confirmed_suffix)
+
+		if (first_result == SKIP || result == SKIP) && result != FAILED && result != DONE {
+			// At least one arm could not be tested, and the other did not
+			// fail.  Since confirmed_suffix failed, presume that the failure
+			// is in an untested arm, and continue below it; with luck,
+			// longer suffixes can be tested.  If both arms are untested,
+			// keep the other as an alternative, in case of a dead end.
+			// An untested arm with a single trigger cannot be split further;
+			// it may be the failure, or it may hide one half of a failure
+			// that needs two or more triggers.  Exclude it, and if nothing
+			// else is left untested, not even an alternative, search again
+			// without it.
+			var untested, single []string
+			for _, arm := range []struct {
+				suffix string
+				result int
+				count  int
+			}{{a + confirmed_suffix, first_result, first_count}, {b + confirmed_suffix, result, ss.lastCount}} {
+				switch {
+				case arm.result != SKIP:
+				case arm.count > 1:
+					untested = append(untested, arm.suffix)
+				case arm.count == 1:
+					single = append(single, arm.suffix)
+				}
+			}
+			for _, x := range single {
+				s.printf("Could not test %s, a single trigger, excluding it\n", x)
+				s.excludes = append(s.excludes, x)
+			}
+			if len(untested) > 0 {
+				for _, x := range untested[1:] {
+					ss.Alternatives = append(ss.Alternatives, ss.alternative(x))
+				}
+				s.printf("Could not test %s, presuming it contains the failure\n", untested[0])
+				confirmed_suffix = untested[0]
+				continue
+			}
+			if len(single) > 0 && len(ss.Alternatives) == 0 {
+				ss.Hashes = append([]string{}, start.Hashes...)
+				ss.NextSingleton = start.NextSingleton
+				s.printf("Restarting search from %s without untestable triggers\n", start.Suffix)
+				confirmed_suffix = start.Suffix
+				continue
+			}
+			s.printf("Could not test a single trigger, discard path\n")
+			if alt, ok := ss.backtrack(); ok {
+				confirmed_suffix = alt
+				continue
+			}
+			return false
+		}
+
+		switch result {
+		case FAILED:
+			confirmed_suffix = ss.Suffix
+			continue
+		case PASSED:
+			if first_result == PASSED {
+				s.printf("Both trials unexpectedly succeeded\n")
+				// 0xyz and 1xyz both succeeded alone, but xyz failed.
+				// Failure therefore requires at least 2 hits, one in
+				// 0xyz and one in 1xyz.  Therefore, put 1xyz in the set
+				// of confirmed (i.e., contains a non-isolated failure)
+				// mark 0xyz as confirmed for local search, and continue.
+				if 0 == 8192&s.rng.Int() {
+					a, b = b, a
+				}
+				ss.Hashes = append(ss.Hashes, b+confirmed_suffix)
+				confirmed_suffix = a + confirmed_suffix
+				continue
+			}
+			fallthrough
+
+		case PASSED0, DONE0, UNRELATED:
+			// If we are here, the test is flaky,
+			// or an unrelated failure hides the one being searched for.
+			if result == UNRELATED || first_result == UNRELATED {
+				s.printf("Unrelated failure, discard path\n")
+			} else {
+				s.printf("Combination of empty and pass, discard path (test is flaky)\n")
+			}
+			if ss.NextSingleton == len(ss.Hashes) {
+				if alt, ok := ss.backtrack(); ok {
+					confirmed_suffix = alt
+					continue
+				}
+				return false
+			}
+			confirmed_suffix = ss.Hashes[len(ss.Hashes)-1]
+			ss.Hashes = ss.Hashes[0 : len(ss.Hashes)-1]
+			continue
+
+		case DONE:
+			if ss.NextSingleton == len(ss.Hashes) {
+				return true
+			}
+			// Randomly choose another place to work.
+			j := s.rng.Intn(len(ss.Hashes)-ss.NextSingleton) + ss.NextSingleton
+			confirmed_suffix = ss.Hashes[j]
+			ss.Hashes[j] = ss.Hashes[ss.NextSingleton]
+			ss.Hashes[ss.NextSingleton] = ss.Suffix
+			ss.NextSingleton++
+			continue
+		}
+	}
+	s.printf("Reached the hash limit of %d bits without isolating a failure; try a longer limit\n", s.opts.HashLimit)
+	return false
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var searchTests = []struct {
+	name     string
+	failures [][]string // names of the points that together cause each failure
+	flake    float64    // probability that a failing configuration passes
+	repeat   int        // search option Repeat
+	multiple int        // search option Multiple
+	bisect   bool       // use the bisect protocol
+	collide  string     // a point whose hash is shared by another point, collide+"'"
+	focus    string     // search option Focus; only the failures it names are found
+	budget   int        // the most trials the search may use
+}{
+	{name: "single point", failures: [][]string{{"f17"}}, budget: 40},
+	{name: "single point, bisect protocol", failures: [][]string{{"f17"}}, bisect: true, budget: 40},
+	{name: "two points", failures: [][]string{{"f3", "f150"}}, budget: 80},
+	{name: "three points", failures: [][]string{{"f3", "f50", "f120"}}, budget: 120},
+	{name: "three independent failures", failures: [][]string{{"f5"}, {"f60"}, {"f150"}}, multiple: 3, budget: 150},
+	{name: "three independent failures, focused", failures: [][]string{{"f5"}, {"f60"}, {"f150"}}, multiple: 3, focus: "f5", budget: 80},
+	{name: "flaky, repeated", failures: [][]string{{"f17"}}, flake: 0.2, repeat: 5, budget: 60},
+	{name: "hash collision", failures: [][]string{{"f17"}}, collide: "f17", budget: 40},
+}
+
+// TestSearch searches simulated tests in memory, and checks that the
+// search finds their failures within a budget of trials.
+func TestSearch(t *testing.T) {
+	names := fNames(200)
+	for _, test := range searchTests {
+		t.Run(test.name, func(t *testing.T) {
+			sim := &simulation{
+				points:   points(names...),
+				failures: test.failures,
+				flake:    test.flake,
+				rand:     rand.New(rand.NewSource(1)),
+			}
+			if test.collide != "" {
+				p := points(test.collide)[0]
+				sim.points = append(sim.points, point{name: test.collide + "'", hash: p.hash})
+			}
+			multiple := test.multiple
+			if multiple == 0 {
+				multiple = 1
+			}
+			var narrative bytes.Buffer
+			s := New(sim, Options{
+				EnvPrefix:     "GOCOMPILEDEBUG=",
+				HashVar:       "gossahash",
+				Multiple:      multiple,
+				Bisect:        test.bisect,
+				BisectPattern: test.bisect,
+				Repeat:        test.repeat,
+				Focus:         test.focus,
+				Seed:          1,
+				Out:           &narrative,
+			})
+			sss := s.Run("", "")
+			defer func() {
+				if t.Failed() {
+					t.Logf("search narrative:\n%s", narrative.Bytes())
+				}
+			}()
+			if s.Trials() > test.budget {
+				t.Errorf("used %d trials, budget is %d", s.Trials(), test.budget)
+			}
+
+			var found []string
+			for _, ss := range sss {
+				var points []string
+				for _, ns := range sim.names(ss) {
+					if len(ns) != 1 && !(test.collide != "" && len(ns) == 2) {
+						t.Fatalf("%s matches %d points, %v", ss.Env(false), len(ns), ns)
+					}
+					points = append(points, ns[0])
+				}
+				sort.Strings(points)
+				found = append(found, strings.Join(points, "+"))
+				if test.collide != "" && len(ss.Collisions[ss.Suffix]) != 2 {
+					t.Errorf("collision of %s not reported", test.collide)
+				}
+			}
+			var want []string
+			for _, f := range test.failures {
+				if !strings.Contains(strings.Join(f, "+"), test.focus) {
+					continue
+				}
+				f = append([]string{}, f...)
+				sort.Strings(f)
+				want = append(want, strings.Join(f, "+"))
+			}
+			sort.Strings(found)
+			sort.Strings(want)
+			if !reflect.DeepEqual(found, want) {
+				t.Errorf("found %v, want %v", found, want)
+			}
+		})
+	}
+}
+
+const triggerOutput = `unrelated line
+gossahash triggered a.f 0x1234
+gossahash triggered a.f 0x1234
+gossahash0 triggered b.g 0x5678
+	gossahash triggered /tmp/go-build99/b001/c.go:3 0x7
+a.f [bisect-match 0x1234]
+`
+
+func TestMatchTrigger(t *testing.T) {
+	tests := []struct {
+		name     string
+		suffix   string
+		bisect   bool
+		rewrites []Rewrite
+		want     map[string]int
+		last     string
+	}{
+		{"trigger lines", "", false, nil, map[string]int{"0x1234": 2, "0x7": 1}, "/tmp/go-build99/b001/c.go:3"},
+		{"bisect markers", "00", true, nil, map[string]int{"0x1234": 1}, "a.f"},
+		{"bisect markers, other suffix", "1", true, nil, map[string]int{}, ""},
+		{"normalized", "", false, DefaultRewrites, map[string]int{"0x1234": 2, "0x7": 1}, "$WORK/b001/c.go:3"},
+	}
+	for _, test := range tests {
+		m, last := MatchTrigger([]byte(triggerOutput), "gossahash", test.suffix, test.bisect, test.rewrites...)
+		if !reflect.DeepEqual(m, test.want) || last != test.last {
+			t.Errorf("%s: MatchTrigger = %v, %q, want %v, %q", test.name, m, last, test.want, test.last)
+		}
+	}
+}
+
+func TestMatchCollisions(t *testing.T) {
+	full := fmt.Sprintf("%064b", uint64(0x1234))
+	tests := []struct {
+		name   string
+		output string
+		want   map[string][]string
+	}{
+		{"hex", "gossahash triggered a.f 0x1234\ngossahash triggered b.g 0x1234\n", map[string][]string{"0x1234": {"a.f", "b.g"}}},
+		{"64 binary digits", "gossahash triggered a.f " + full + "\ngossahash triggered b.g " + full + "\n", map[string][]string{full: {"a.f", "b.g"}}},
+		{"truncated", "gossahash triggered a.f 110100\ngossahash triggered b.g 110100\n", nil},
+		{"distinct", "gossahash triggered a.f 0x1234\ngossahash triggered b.g 0x5678\n", nil},
+		{"same name", "gossahash triggered a.f 0x1234\ngossahash triggered a.f 0x1234\n", nil},
+	}
+	for _, test := range tests {
+		if got := MatchCollisions([]byte(test.output), "gossahash", "", false); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: MatchCollisions = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Truncated hashes of different names are different triggers.
+	m, _ := MatchTrigger([]byte(tests[2].output), "gossahash", "", false)
+	if len(m) != 2 {
+		t.Errorf("MatchTrigger of truncated hashes = %v, want 2 triggers", m)
+	}
+}
+
+func TestParseExcludes(t *testing.T) {
+	for in, want := range map[string][]string{
+		"":                 nil,
+		"0101":             {"0101"},
+		"0101,11-001+1 10": {"0101", "11", "001", "1", "10"},
+		"-0101-":           {"0101"},
+	} {
+		if got := ParseExcludes(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseExcludes(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dr2chase/gossahash/hashdebug"
+)
+
+// A point is a place where a simulated change may be applied, such
+// as a function, with its hash.
+type point struct {
+	name string
+	hash uint64
+}
+
+// points returns a point for each name, hashed as by hashdebug.Hash.
+func points(names ...string) []point {
+	ps := make([]point, len(names))
+	for i, n := range names {
+		ps[i] = point{name: n, hash: hashdebug.Hash(n, 0)}
+	}
+	return ps
+}
+
+// A simulation is an Oracle that runs no command, but instead
+// decides in memory which of its points a trial enables, and fails
+// if all the points of any of its failures are enabled.  It reports
+// each enabled point with a trigger line, as a program using package
+// hashdebug would, so searches of a simulation exercise everything
+// but the running of the test.  A simulation assumes that the
+// environment setting of a trial ends with the hash variable's value,
+// with no HashPrefix.  A failing trial crashes, with a panic that
+// names the points of its failure, so failures can be told apart.
+// A trial that does not fail, but enables one of its skips, is
+// skipped, as if the change at that point broke something else.
+type simulation struct {
+	points   []point
+	failures [][]string // Each failure is the names of the points that together cause it.
+	skips    []string   // Names of the points that make a trial untestable.
+
+	// flake is the probability that a failing configuration passes
+	// anyway; rand supplies the randomness, and must not be nil if
+	// flake is not zero.
+	flake float64
+	rand  *rand.Rand
+
+	mu sync.Mutex
+}
+
+// Try decides the outcome of t.
+func (sim *simulation) Try(ctx context.Context, t *Trial) *Outcome {
+	value := t.Env
+	if i := strings.LastIndex(value, t.Name+"="); i != -1 {
+		value = value[i+len(t.Name)+1:]
+	}
+	hd, err := hashdebug.Parse(t.Name, value)
+	if err != nil {
+		return &Outcome{Unrelated: true, Why: err.Error()}
+	}
+	bisect, _ := t.syntax()
+
+	var b bytes.Buffer
+	enabled := make(map[string]bool)
+	for _, p := range sim.points {
+		name, ok := hd.MatchHash(p.hash)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			name = t.Name
+		}
+		enabled[p.name] = true
+		if bisect {
+			fmt.Fprintf(&b, "%s [bisect-match 0x%x]\n", p.name, p.hash)
+		} else {
+			fmt.Fprintf(&b, "%s triggered %s 0x%x\n", name, p.name, p.hash)
+		}
+	}
+
+	o := &Outcome{Output: b.Bytes()}
+	for _, f := range sim.failures {
+		all := true
+		for _, n := range f {
+			all = all && enabled[n]
+		}
+		if all {
+			o.Failed = true
+			o.Why = "simulated failure of " + strings.Join(f, "+")
+			o.Crash = "panic: " + o.Why
+			o.ExitCode = 2
+			break
+		}
+	}
+	for _, n := range sim.skips {
+		if !o.Failed && enabled[n] {
+			o.Skipped = true
+			o.Why = "simulated skip of " + n
+			o.ExitCode = 125
+			break
+		}
+	}
+	if o.Failed && sim.flake > 0 {
+		sim.mu.Lock()
+		flaked := sim.rand.Float64() < sim.flake
+		sim.mu.Unlock()
+		if flaked {
+			o.Failed = false
+			o.Why = ""
+			o.Crash = ""
+			o.ExitCode = 0
+		}
+	}
+	o.Triggers, o.LastTrigger = t.Match(o.Output)
+	o.Collisions = t.Collisions(o.Output)
+	o.HashTriggers = t.HashTriggers(o.Output)
+	return o
+}
+
+// pointWithSuffix returns a new point, named prefix followed by a
+// number, whose hash ends in the binary suffix.
+func pointWithSuffix(prefix, suffix string) point {
+	mask := uint64(1)<<len(suffix) - 1
+	want, _ := strconv.ParseUint(suffix, 2, 64)
+	for i := 0; ; i++ {
+		p := points(fmt.Sprintf("%s%d", prefix, i))[0]
+		if p.hash&mask == want {
+			return p
+		}
+	}
+}
+
+// names returns the names of the points that ss's suffix and hashes
+// match, in that order, one list for each.
+func (sim *simulation) names(ss *State) [][]string {
+	var names [][]string
+	for _, suffix := range append([]string{ss.Suffix}, ss.Hashes...) {
+		hd, err := hashdebug.Parse("", suffix)
+		var ns []string
+		for _, p := range sim.points {
+			if _, ok := hd.MatchHash(p.hash); ok && err == nil {
+				ns = append(ns, p.name)
+			}
+		}
+		names = append(names, ns)
+	}
+	return names
+}
+
+// found returns the failures of sss, sorted, each written as the
+// names of the points that its suffix and hashes match, sorted and
+// joined by "+".
+func (sim *simulation) found(sss []*State) []string {
+	var found []string
+	for _, ss := range sss {
+		var points []string
+		for _, ns := range sim.names(ss) {
+			points = append(points, strings.Join(ns, "|"))
+		}
+		sort.Strings(points)
+		found = append(found, strings.Join(points, "+"))
+	}
+	sort.Strings(found)
+	return found
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lowBits returns the low n bits of the hash of the point named name,
+// as a binary suffix.
+func lowBits(name string, n int) string {
+	s := fmt.Sprintf("%064b", points(name)[0].hash)
+	return s[64-n:]
+}
+
+// shared returns the number of low bits that the hashes of a and b
+// share.
+func shared(a, b string) int {
+	n := 0
+	for n < 64 && lowBits(a, n+1) == lowBits(b, n+1) {
+		n++
+	}
+	return n
+}
+
+// flip returns suffix with its first bit inverted.
+func flip(suffix string) string {
+	if suffix[0] == '0' {
+		return "1" + suffix[1:]
+	}
+	return "0" + suffix[1:]
+}
+
+// TestSearchSkip searches simulated failures where some
+// configurations cannot be tested, because they enable a point that
+// breaks something else.
+func TestSearchSkip(t *testing.T) {
+	k := shared("f3", "f150")
+	tests := []struct {
+		name     string
+		failures [][]string
+		skips    []point // extra points that make a trial untestable
+		want     []string
+		narrates string // the narrative of some search includes this
+	}{
+		{
+			name:     "skip point beside a single failure",
+			failures: [][]string{{"f17"}},
+			skips:    []point{pointWithSuffix("s", lowBits("f17", 3))},
+			want:     []string{"f17"},
+			narrates: "skipped",
+		},
+		{
+			name:     "skip point elsewhere",
+			failures: [][]string{{"f17"}},
+			skips:    []point{pointWithSuffix("s", flip(lowBits("f17", 1))), pointWithSuffix("t", flip(lowBits("f17", 2)))},
+			want:     []string{"f17"},
+			narrates: "skipped",
+		},
+		{
+			// The arm with f150 is skipped, the one with f3 passes.
+			name:     "skip point beside one half of a two-point failure",
+			failures: [][]string{{"f3", "f150"}},
+			skips:    []point{pointWithSuffix("s", lowBits("f150", k+1))},
+			want:     []string{"f150+f3"},
+			narrates: "Restarting search",
+		},
+		{
+			name:     "skip point beside the other half of a two-point failure",
+			failures: [][]string{{"f3", "f150"}},
+			skips:    []point{pointWithSuffix("s", lowBits("f3", k+1))},
+			want:     []string{"f150+f3"},
+			narrates: "Restarting search",
+		},
+		{
+			// Both arms are skipped at the split between f3 and f150.
+			name:     "skip points beside both halves of a two-point failure",
+			failures: [][]string{{"f3", "f150"}},
+			skips:    []point{pointWithSuffix("s", lowBits("f3", k+1)), pointWithSuffix("t", lowBits("f150", k+1))},
+			want:     []string{"f150+f3"},
+			narrates: "Dead end, backtracking",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			narrated := false
+			for seed := int64(1); seed < 30; seed++ {
+				sim := &simulation{points: points(fNames(200)...), failures: test.failures}
+				for _, p := range test.skips {
+					sim.points = append(sim.points, p)
+					sim.skips = append(sim.skips, p.name)
+				}
+				var narrative bytes.Buffer
+				s := New(sim, Options{
+					EnvPrefix: "GOCOMPILEDEBUG=",
+					HashVar:   "gossahash",
+					Multiple:  1,
+					Seed:      seed,
+					Out:       &narrative,
+				})
+				got := sim.found(s.Run("", ""))
+				if !reflect.DeepEqual(got, test.want) {
+					t.Fatalf("seed %d: found %v, want %v\n%s", seed, got, test.want, narrative.Bytes())
+				}
+				narrated = narrated || strings.Contains(narrative.String(), test.narrates)
+			}
+			if !narrated {
+				t.Errorf("no search narrated %q", test.narrates)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A StopRule ends a trial early, as soon as a line of the command's
+// output matches Pattern, with the outcome given by Result:
+//
+//	"fail"         the trial failed
+//	"pass"         the trial passed
+//	"untriggered"  the trial passed, if no triggers have been reported yet
+//
+// For instance, a test suite that prints "FAIL" as soon as a test
+// fails need not be run to the end, and if a build reaches its last
+// step without triggering anything, the change being searched cannot
+// have affected it.
+//
+// The search also counts the distinct triggers of a trial: a failure
+// with one trigger is isolated, and a pass with none enabled nothing.
+// Output cut short could miss triggers, so a "fail" rule stops the
+// trial only once two triggers have been reported, and a "pass" rule
+// once one has; until then, the command runs to the end, and the rule
+// still decides its outcome.
+type StopRule struct {
+	Pattern *regexp.Regexp
+	Result  string
+}
+
+// ParseStopRule parses a rule written as REGEX=RESULT.
+func ParseStopRule(s string) (StopRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i == -1 {
+		return StopRule{}, fmt.Errorf("stop rule %q is not of the form REGEX=RESULT", s)
+	}
+	switch s[i+1:] {
+	case "fail", "pass", "untriggered":
+	default:
+		return StopRule{}, fmt.Errorf("stop rule %q: result must be fail, pass, or untriggered", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return StopRule{}, err
+	}
+	return StopRule{Pattern: re, Result: s[i+1:]}, nil
+}
+
+// A watcher collects the output of a command, and checks each line
+// against stop rules as it arrives.  When a rule decides the outcome
+// of the trial, and enough triggers have been reported that the rest
+// of the output cannot change their count in a way that matters (see
+// StopRule), the rule is sent on stopped, once.
+type watcher struct {
+	rules    []StopRule
+	triggers func(output []byte) int // counts the distinct triggers reported so far
+	stopped  chan StopRule
+
+	mu      sync.Mutex
+	b       bytes.Buffer
+	scanned int       // offset of the first line not yet checked
+	matched *StopRule // the first rule to match
+	done    bool      // a rule has fired
+}
+
+func newWatcher(rules []StopRule, triggers func(output []byte) int) *watcher {
+	return &watcher{rules: rules, triggers: triggers, stopped: make(chan StopRule, 1)}
+}
+
+// enough reports whether output has enough triggers for r to stop
+// the trial.
+func (w *watcher) enough(r *StopRule, output []byte) bool {
+	switch r.Result {
+	case "fail":
+		return w.triggers(output) >= 2
+	case "pass":
+		return w.triggers(output) >= 1
+	}
+	return true
+}
+
+func (w *watcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.b.Write(p)
+	if w.done || len(w.rules) == 0 {
+		return len(p), nil
+	}
+	data := w.b.Bytes()
+	for w.matched == nil {
+		nl := bytes.IndexByte(data[w.scanned:], '\n')
+		if nl == -1 {
+			break
+		}
+		line := data[w.scanned : w.scanned+nl]
+		w.scanned += nl + 1
+		for _, r := range w.rules {
+			if !r.Pattern.Match(line) {
+				continue
+			}
+			if r.Result == "untriggered" && w.triggers(data[:w.scanned]) > 0 {
+				continue
+			}
+			r := r
+			w.matched = &r
+			break
+		}
+	}
+	// Once a rule has matched, count the triggers again with each
+	// write, not each line.
+	if w.matched != nil && w.enough(w.matched, data) {
+		w.done = true
+		w.stopped <- *w.matched
+	}
+	return len(p), nil
+}
+
+// Matched returns the first rule that matched the output, whether or
+// not it stopped the trial, or nil.
+func (w *watcher) Matched() *StopRule {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.matched
+}
+
+// Bytes returns the output collected so far.
+func (w *watcher) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.b.Bytes()...)
+}
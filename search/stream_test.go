@@ -0,0 +1,132 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseStopRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		pattern string
+		result  string // "" means an error
+	}{
+		{"^--- FAIL=fail", "^--- FAIL", "fail"},
+		{"^ok=pass", "^ok", "pass"},
+		{"^# linking=untriggered", "^# linking", "untriggered"},
+		{"a=b=fail", "a=b", "fail"}, // the last '=' separates the result
+		{"=pass", "", "pass"},
+		{"FAIL", "", ""},
+		{"FAIL=crash", "", ""},
+		{"FAIL=", "", ""},
+		{"(=fail", "", ""},
+	}
+	for _, test := range tests {
+		r, err := ParseStopRule(test.in)
+		if test.result == "" {
+			if err == nil {
+				t.Errorf("ParseStopRule(%q) = %q=%s, want error", test.in, r.Pattern, r.Result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseStopRule(%q): %v", test.in, err)
+			continue
+		}
+		if r.Pattern.String() != test.pattern || r.Result != test.result {
+			t.Errorf("ParseStopRule(%q) = %q=%s, want %q=%s", test.in, r.Pattern, r.Result, test.pattern, test.result)
+		}
+	}
+}
+
+// stopRules parses rules, which must be valid.
+func stopRules(t *testing.T, rules ...string) []StopRule {
+	t.Helper()
+	var rs []StopRule
+	for _, s := range rules {
+		r, err := ParseStopRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// lineTriggers counts the lines of output that begin with "trigger".
+func lineTriggers(output []byte) int {
+	n := 0
+	for _, l := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(l, "trigger") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWatcher(t *testing.T) {
+	rules := []string{"^FAIL=fail", "^ok=pass", "^link=untriggered"}
+	tests := []struct {
+		name    string
+		writes  []string
+		stopped string // the result of the rule that stopped the trial, if one did
+		after   int    // the number of writes after which it stopped
+		matched string // the result of the rule that matched, if one did
+	}{
+		{"no match", []string{"trigger 1\n", "trigger 2\n", "done\n"}, "", 0, ""},
+		{"fail", []string{"trigger 1\ntrigger 2\n", "FAIL\n", "more\n"}, "fail", 2, "fail"},
+		{"fail, one trigger", []string{"trigger 1\n", "FAIL\n", "more\n"}, "", 0, "fail"},
+		{"fail, triggers after", []string{"trigger 1\n", "FAIL\n", "more\n", "trigger 2\n", "more\n"}, "fail", 4, "fail"},
+		{"fail, triggers in the same write", []string{"trigger 1\nFAIL\ntrigger 2\n", "more\n"}, "fail", 1, "fail"},
+		{"pass", []string{"trigger 1\n", "ok\n"}, "pass", 2, "pass"},
+		{"pass, no triggers", []string{"ok\n", "more\n"}, "", 0, "pass"},
+		{"pass, then trigger", []string{"ok\n", "trigger 1\n", "more\n"}, "pass", 2, "pass"},
+		{"untriggered", []string{"build\n", "link\n", "more\n"}, "untriggered", 2, "untriggered"},
+		{"untriggered, triggered", []string{"trigger 1\n", "link\n", "more\n"}, "", 0, ""},
+		{"first match decides", []string{"FAIL\n", "ok\n", "trigger 1\n", "trigger 2\n"}, "fail", 4, "fail"},
+		{"partial line", []string{"trigger 1\ntrigger 2\nFA", "IL\n"}, "fail", 2, "fail"},
+	}
+	for _, test := range tests {
+		w := newWatcher(stopRules(t, rules...), lineTriggers)
+		stopped, after := "", 0
+		for i, s := range test.writes {
+			w.Write([]byte(s))
+			select {
+			case r := <-w.stopped:
+				if stopped != "" {
+					t.Errorf("%s: stopped twice", test.name)
+				}
+				stopped, after = r.Result, i+1
+			default:
+			}
+		}
+		if stopped != test.stopped || after != test.after {
+			t.Errorf("%s: stopped %q after %d writes, want %q after %d", test.name, stopped, after, test.stopped, test.after)
+		}
+		matched := ""
+		if r := w.Matched(); r != nil {
+			matched = r.Result
+		}
+		if matched != test.matched {
+			t.Errorf("%s: matched %q, want %q", test.name, matched, test.matched)
+		}
+		if got, want := w.Bytes(), strings.Join(test.writes, ""); !bytes.Equal(got, []byte(want)) {
+			t.Errorf("%s: collected %q, want %q", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"context"
+)
+
+// A Flake records a configuration that both passed and failed
+// when it was run repeatedly.
+type Flake struct {
+	Env    string // The environment setting of the trial.
+	Suffix string // The hash suffix of the trial.
+	Runs   int    // Number of times the test was run.
+	Fails  int    // Number of those runs that failed.
+}
+
+// Rate returns the fraction of runs that failed.
+func (f Flake) Rate() float64 {
+	return float64(f.Fails) / float64(f.Runs)
+}
+
+// Flakes returns the configurations seen to be flaky so far, in the
+// order they were tried.
+func (s *Searcher) Flakes() []Flake {
+	return s.flakes
+}
+
+// failedVote reports whether fails out of runs is enough to
+// count as a failure.
+func (s *Searcher) failedVote(fails, runs int) bool {
+	return float64(fails) >= s.opts.FailThreshold*float64(runs)
+}
+
+// borderline reports whether a single run's different result
+// would have changed the vote.
+func (s *Searcher) borderline(fails, runs int) bool {
+	v := s.failedVote(fails, runs)
+	return s.failedVote(fails+1, runs) != v || fails > 0 && s.failedVote(fails-1, runs) != v
+}
+
+// vote runs t the configured number of times and combines the
+// outcomes by vote.  If the vote is close, it runs t up to twice as
+// many times.  Skipped and unrelated runs do not vote, and if no run
+// votes, the outcome is the last of them.  The combined outcome
+// carries the triggers of all the runs and the output of the last
+// run that agreed with the vote.  vote returns nil if ctx is canceled.
+func (s *Searcher) vote(ctx context.Context, t *Trial) *Outcome {
+	n := s.opts.Repeat
+	if n <= 1 {
+		o := s.oracle.Try(ctx, t)
+		if o != nil {
+			s.focus(o)
+			o.Runs = 1
+			if o.Failed {
+				o.Fails = 1
+			}
+		}
+		return o
+	}
+
+	var tries, runs, fails int
+	var failed, passed, other *Outcome
+	triggers := make(map[string]int)
+	for tries < 2*n && (runs < n || s.borderline(fails, runs)) {
+		o := s.oracle.Try(ctx, t)
+		if ctx.Err() != nil || o == nil {
+			return nil
+		}
+		s.focus(o)
+		tries++
+		for k, v := range o.Triggers {
+			triggers[k] += v
+		}
+		switch {
+		case o.Skipped || o.Unrelated:
+			other = o
+			continue
+		case o.Failed:
+			fails++
+			failed = o
+		default:
+			passed = o
+		}
+		runs++
+	}
+
+	var o *Outcome
+	switch {
+	case runs == 0:
+		o = other
+	case s.failedVote(fails, runs):
+		o = failed
+	default:
+		o = passed
+	}
+	o.Triggers = triggers
+	o.Runs = runs
+	o.Fails = fails
+	return o
+}
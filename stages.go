@@ -0,0 +1,122 @@
+// Copyright 2018 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dr2chase/gossahash/search"
+)
+
+// A stage is the failure found by searching one hash variable of a
+// -stages search, with its triggers.
+type stage struct {
+	ss       *search.State
+	triggers []hashTrigger
+}
+
+// searchStages searches each hash variable of stages in turn, each
+// within the failure found by the ones before it, by adding their
+// settings to the environment prefix of opts.  It reports the failure
+// found at each stage, and then all of them together.
+func searchStages(oracle *search.CommandOracle, opts search.Options, stages []string, commandLine []string) {
+	opts.Multiple = 1
+	start := time.Now()
+	var done []*stage
+	var r *Report
+
+	fmt.Printf("Searching with -seed=%d\n", seed)
+	for i, hashVar := range stages {
+		hash_ev_string = hashVar
+		hash_ev_name = hashVar
+		if j := strings.Index(hash_ev_name, "="); j != -1 {
+			hash_ev_name = hash_ev_name[:j]
+		}
+		opts.HashVar = hashVar
+		fmt.Printf("Stage %d of %d, searching %s with %s\n", i+1, len(stages), hashVar, opts.EnvPrefix)
+
+		searcher := search.New(oracle, opts)
+		if preflight {
+			checkPreflight(searcher, opts.EnvPrefix)
+		}
+		sss := searcher.Run(initialSuffix, "")
+		printTrouble(searcher)
+		if jsonReport != "" {
+			sr := newReport(searcher, sss, oracle, commandLine, start)
+			for _, f := range sr.Failures {
+				f.Stage = hashVar
+			}
+			if r == nil {
+				r = sr
+			} else {
+				r.Trials += sr.Trials
+				r.ElapsedSeconds = sr.ElapsedSeconds
+				r.Failures = append(r.Failures, sr.Failures...)
+				r.Flakes = append(r.Flakes, sr.Flakes...)
+				r.Unrelated = append(r.Unrelated, sr.Unrelated...)
+			}
+			// Each stage finds one failure; the stages are not clusters.
+			r.Clusters = nil
+		}
+		if len(sss) == 0 {
+			fmt.Printf("Stage %s found no failure, stopping\n", hashVar)
+			break
+		}
+
+		ss := sss[0]
+		finish(ss, oracle)
+		if oracle.Tests != nil {
+			finishTests(ss, searcher.Baseline())
+		}
+		done = append(done, &stage{ss: ss, triggers: hashTriggers(ss)})
+		opts.EnvPrefix = ss.Env(false) + ","
+	}
+
+	if len(done) > 0 {
+		printStages(done, oracle)
+	}
+	fmt.Printf("Searched with -seed=%d\n", seed)
+
+	if r != nil {
+		if err := r.write(jsonReport); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON report %s\n", err)
+		}
+	}
+}
+
+// printStages reports the failures found by the stages of a search,
+// with the setting of the last, which includes all the others.
+func printStages(done []*stage, oracle *search.CommandOracle) {
+	last := done[len(done)-1].ss
+	fn := ""
+	for _, st := range done {
+		if f := gossafunc(st.ss.LastTrigger); f != "" {
+			fn = f
+		}
+	}
+	fmt.Printf("FINISHED %d stages, suggest this command line for debugging:\n", len(done))
+	if fn != "" {
+		fmt.Printf("GOSSAFUNC='%s' ", fn)
+	}
+	fmt.Printf("%s %s\n", last.Env(false), oracle.CommandLine())
+	for _, st := range done {
+		for _, ht := range st.triggers {
+			fmt.Printf("\t%s=%s triggers %s\n", ht.Var, ht.Hash, ht.Trigger)
+		}
+	}
+}